@@ -0,0 +1,30 @@
+//go:build go1.23
+
+package sqlp
+
+import (
+	"context"
+	. "github.com/ByteSizedMarius/sqlp/sqlpdb"
+	"iter"
+)
+
+// QueryIter is QueryEach as an iterator. An error ends the iteration and is yielded with the zero value of T.
+// The rows are closed when the iteration ends, including when the loop is left early.
+func QueryIter[T any](query string, args ...any) iter.Seq2[T, error] {
+	return QueryIterDb[T](db, query, args...)
+}
+
+// QueryIterContext is QueryIter with a context.
+func QueryIterContext[T any](ctx context.Context, query string, args ...any) iter.Seq2[T, error] {
+	return QueryIterDbContext[T](ctx, db, query, args...)
+}
+
+// GetAllIter is GetAll as an iterator. See QueryIter.
+func GetAllIter[T Repo]() iter.Seq2[T, error] {
+	return GetIterRdb[T](db)
+}
+
+// GetAllIterContext is GetAllIter with a context.
+func GetAllIterContext[T Repo](ctx context.Context) iter.Seq2[T, error] {
+	return GetIterRdbContext[T](ctx, db)
+}
@@ -9,18 +9,34 @@
 package sqlp
 
 import (
+	"context"
 	"database/sql"
 	. "github.com/ByteSizedMarius/sqlp/sqlpdb"
+	"github.com/ByteSizedMarius/sqlp/sqlpdialect"
 )
 
 var (
 	// Global database handle to use for queries
 	db *sql.DB
+
+	// Dialect of the global database handle
+	dialect sqlpdialect.Dialect
 )
 
 // SetDatabase sets the global database handle to be used by the Query function.
 func SetDatabase(sqldb *sql.DB) {
 	db = sqldb
+	if dialect != nil {
+		RegisterDialect(db, dialect)
+	}
+}
+
+// SetDialect sets the dialect of the global database handle.
+func SetDialect(d sqlpdialect.Dialect) {
+	dialect = d
+	if db != nil {
+		RegisterDialect(db, dialect)
+	}
 }
 
 // ——————————————————————————————————————————————————————————————————————————————
@@ -31,60 +47,354 @@ func Query[T any](query string, args ...any) (results []T, err error) {
 	return QueryDb[T](db, query, args...)
 }
 
+func QueryContext[T any](ctx context.Context, query string, args ...any) (results []T, err error) {
+	return QueryDbContext[T](ctx, db, query, args...)
+}
+
+// QueryEach is Query, but passes the rows to fn one at a time instead of collecting them in a slice.
+// If fn returns an error, the iteration stops and the error is returned.
+func QueryEach[T any](query string, fn func(T) error, args ...any) error {
+	return QueryEachDb[T](db, query, fn, args...)
+}
+
+// QueryEachContext is QueryEach with a context.
+func QueryEachContext[T any](ctx context.Context, query string, fn func(T) error, args ...any) error {
+	return QueryEachDbContext[T](ctx, db, query, fn, args...)
+}
+
 func QueryRow[T any](query string, args ...any) (result T, err error) {
 	return QueryRowDb[T](db, query, args...)
 }
 
+func QueryRowContext[T any](ctx context.Context, query string, args ...any) (result T, err error) {
+	return QueryRowDbContext[T](ctx, db, query, args...)
+}
+
 func QueryBasic[T string | int | int64 | float32 | float64](query string, args ...any) (results []T, err error) {
 	return QueryBasicDb[T](db, query, args...)
 }
 
+func QueryBasicContext[T string | int | int64 | float32 | float64](ctx context.Context, query string, args ...any) (results []T, err error) {
+	return QueryBasicDbContext[T](ctx, db, query, args...)
+}
+
 func QueryBasicRow[T string | int | int64 | float32 | float64](query string, args ...any) (result T, err error) {
 	return QueryBasicRowDb[T](db, query, args...)
 }
 
+func QueryBasicRowContext[T string | int | int64 | float32 | float64](ctx context.Context, query string, args ...any) (result T, err error) {
+	return QueryBasicRowDbContext[T](ctx, db, query, args...)
+}
+
 // ——————————————————————————————————————————————————————————————————————————————
 // Repo Functions
 // ——————————————————————————————————————————————————————————————————————————————
 
+// From returns a query builder for the Repo type, which composes the clauses and checks the column names:
+//
+//	users, err := sqlp.From[User]().Where("age > ?", 18).OrderBy("name").Limit(10).All(db)
+func From[T Repo]() *Builder[T] {
+	return NewBuilder[T]()
+}
+
 // GetAll retrieves all rows from the table that the Repo type maps to.
 func GetAll[T Repo]() ([]T, error) {
 	return GetRdb[T](db)
 }
 
+// GetAllContext is GetAll with a context.
+func GetAllContext[T Repo](ctx context.Context) ([]T, error) {
+	return GetRdbContext[T](ctx, db)
+}
+
+// GetAllEach is GetAll, but passes the rows to fn one at a time instead of collecting them in a slice.
+func GetAllEach[T Repo](fn func(T) error) error {
+	return GetEachRdb[T](db, fn)
+}
+
+// GetAllEachContext is GetAllEach with a context.
+func GetAllEachContext[T Repo](ctx context.Context, fn func(T) error) error {
+	return GetEachRdbContext[T](ctx, db, fn)
+}
+
+// GetKeyset returns the page of rows following the cursor, sorted by the columns of the options.
+// An empty cursor returns the first page. See sqlpdb.GetKeysetRdb.
+func GetKeyset[T Repo](opts KeysetOptions, cursor string) (KeysetPage[T], error) {
+	return GetKeysetRdb[T](db, opts, cursor)
+}
+
+// GetKeysetContext is GetKeyset with a context.
+func GetKeysetContext[T Repo](ctx context.Context, opts KeysetOptions, cursor string) (KeysetPage[T], error) {
+	return GetKeysetRdbContext[T](ctx, db, opts, cursor)
+}
+
+// Count returns the number of rows of the table that the Repo type maps to, where the where clause is true.
+func Count[T Repo](where string, args ...any) (int64, error) {
+	return CountRdb[T](db, where, args...)
+}
+
+// CountContext is Count with a context.
+func CountContext[T Repo](ctx context.Context, where string, args ...any) (int64, error) {
+	return CountRdbContext[T](ctx, db, where, args...)
+}
+
+// Exists reports whether the table that the Repo type maps to has a row where the where clause is true.
+func Exists[T Repo](where string, args ...any) (bool, error) {
+	return ExistsRdb[T](db, where, args...)
+}
+
+// ExistsContext is Exists with a context.
+func ExistsContext[T Repo](ctx context.Context, where string, args ...any) (bool, error) {
+	return ExistsRdbContext[T](ctx, db, where, args...)
+}
+
+// GetPage returns the rows of the given 1-based page together with the total number of rows matching the
+// where clause. See sqlpdb.GetPageRdb.
+func GetPage[T Repo](where string, page, size int, args ...any) (Page[T], error) {
+	return GetPageRdb[T](db, where, page, size, args...)
+}
+
+// GetPageContext is GetPage with a context.
+func GetPageContext[T Repo](ctx context.Context, where string, page, size int, args ...any) (Page[T], error) {
+	return GetPageRdbContext[T](ctx, db, where, page, size, args...)
+}
+
+// GetPageTx is GetPage, but runs the count and the page query in one transaction, so the total is consistent
+// with the rows.
+func GetPageTx[T Repo](where string, page, size int, args ...any) (Page[T], error) {
+	return GetPageTxContext[T](context.Background(), where, page, size, args...)
+}
+
+// GetPageTxContext is GetPageTx with a context.
+func GetPageTxContext[T Repo](ctx context.Context, where string, page, size int, args ...any) (res Page[T], err error) {
+	err = WithTx(ctx, db, func(tx *Tx) error {
+		res, err = GetPageRdbContext[T](ctx, tx, where, page, size, args...)
+		return err
+	})
+	return
+}
+
 // GetAllWhere retrieves all rows from the table that the Repo type maps to, where the where clause is true.
 // The clause should start with "WHERE" or "ORDERBY".
 func GetAllWhere[T Repo](where string, args ...any) ([]T, error) {
 	return GetWhereRdb[T](db, where, args...)
 }
 
+// GetAllWhereContext is GetAllWhere with a context.
+func GetAllWhereContext[T Repo](ctx context.Context, where string, args ...any) ([]T, error) {
+	return GetWhereRdbContext[T](ctx, db, where, args...)
+}
+
 // GetSingleWhere retrieves the first row from the table that the Repo type maps to that matches the where clause.
 // The clause should start with "WHERE" or "ORDERBY".
 func GetSingleWhere[T Repo](where string, args ...any) (res T, err error) {
 	return GetSingleWhereRdb[T](db, where, args...)
 }
 
+// GetSingleWhereContext is GetSingleWhere with a context.
+func GetSingleWhereContext[T Repo](ctx context.Context, where string, args ...any) (res T, err error) {
+	return GetSingleWhereRdbContext[T](ctx, db, where, args...)
+}
+
 // GetByPk retrieves a single row from the table that the Repo type maps to, where the primary key matches the given value.
 func GetByPk[T Repo](pk any) (T, error) {
 	return GetPkDb[T](db, pk)
 }
 
-// Insert inserts a new row into the table that the Repo type maps to.
+// GetByPkContext is GetByPk with a context.
+func GetByPkContext[T Repo](ctx context.Context, pk any) (T, error) {
+	return GetPkDbContext[T](ctx, db, pk)
+}
+
+// GetByPks retrieves a single row from the table that the Repo type maps to by its composite primary key.
+// The key parts must be given in the order of the primary key fields in the struct.
+func GetByPks[T Repo](pks ...any) (T, error) {
+	return GetPksDb[T](db, pks...)
+}
+
+// GetByPksContext is GetByPks with a context.
+func GetByPksContext[T Repo](ctx context.Context, pks ...any) (T, error) {
+	return GetPksDbContext[T](ctx, db, pks...)
+}
+
+// GetByKey is GetByPk with a typed primary key, which must match the type of the primary key field.
+func GetByKey[T Repo, K comparable](pk K) (T, error) {
+	return GetKeyDb[T, K](db, pk)
+}
+
+// GetByKeyContext is GetByKey with a context.
+func GetByKeyContext[T Repo, K comparable](ctx context.Context, pk K) (T, error) {
+	return GetKeyDbContext[T, K](ctx, db, pk)
+}
+
+// Insert inserts a new row into the table that the Repo type maps to and returns its integer primary key.
+// For other primary key types, 0 is returned; use InsertKey to get them.
 func Insert[T Repo](obj T) (int, error) {
 	return InsertDb[T](db, obj)
 }
 
-// Update updates the row in the table that the Repo type maps to.
-func Update[T Repo](obj T) error {
+// InsertContext is Insert with a context.
+func InsertContext[T Repo](ctx context.Context, obj T) (int, error) {
+	return InsertDbContext[T](ctx, db, obj)
+}
+
+// InsertKey inserts a new row into the table that the Repo type maps to and returns the generated primary key as K,
+// which must match the type of the primary key field.
+func InsertKey[T Repo, K comparable](obj T) (K, error) {
+	return InsertKeyDb[T, K](db, obj)
+}
+
+// InsertKeyContext is InsertKey with a context.
+func InsertKeyContext[T Repo, K comparable](ctx context.Context, obj T) (K, error) {
+	return InsertKeyDbContext[T, K](ctx, db, obj)
+}
+
+// InsertPtr inserts a new row into the table that the Repo type maps to and writes the generated primary key into obj.
+func InsertPtr[T Repo](obj *T) error {
+	return InsertPtrDb[T](db, obj)
+}
+
+// InsertPtrContext is InsertPtr with a context.
+func InsertPtrContext[T Repo](ctx context.Context, obj *T) error {
+	return InsertPtrDbContext[T](ctx, db, obj)
+}
+
+// InsertReturning inserts a new row into the table that the Repo type maps to and reads the inserted row back into obj,
+// which includes the generated primary key as well as defaults set by the database.
+func InsertReturning[T Repo](obj *T) error {
+	return InsertReturningDb[T](db, obj)
+}
+
+// InsertReturningContext is InsertReturning with a context.
+func InsertReturningContext[T Repo](ctx context.Context, obj *T) error {
+	return InsertReturningDbContext[T](ctx, db, obj)
+}
+
+// InsertMany inserts all objects into the table that the Repo type maps to using multi-row inserts,
+// inside a single transaction. See InsertManyDb for details.
+func InsertMany[T Repo](objs []T) error {
+	return InsertManyContext[T](context.Background(), objs)
+}
+
+// InsertManyContext is InsertMany with a context.
+func InsertManyContext[T Repo](ctx context.Context, objs []T) error {
+	return WithTx(ctx, db, func(tx *Tx) error {
+		return InsertManyDbContext[T](ctx, tx, objs)
+	})
+}
+
+// Upsert inserts a new row into the table that the Repo type maps to or updates the existing row with the same
+// primary key.
+func Upsert[T Repo](obj T) error {
+	return UpsertDb[T](db, obj, UpsertOptions{})
+}
+
+// UpsertContext is Upsert with a context.
+func UpsertContext[T Repo](ctx context.Context, obj T) error {
+	return UpsertDbContext[T](ctx, db, obj, UpsertOptions{})
+}
+
+// UpsertWith is Upsert with configurable conflict and update columns.
+func UpsertWith[T Repo](obj T, opts UpsertOptions) error {
+	return UpsertDb[T](db, obj, opts)
+}
+
+// UpsertWithContext is UpsertWith with a context.
+func UpsertWithContext[T Repo](ctx context.Context, obj T, opts UpsertOptions) error {
+	return UpsertDbContext[T](ctx, db, obj, opts)
+}
+
+// Update updates the row in the table that the Repo type maps to and returns the number of affected rows.
+func Update[T Repo](obj T) (int64, error) {
 	return UpdateDb[T](db, obj)
 }
 
+// UpdateContext is Update with a context.
+func UpdateContext[T Repo](ctx context.Context, obj T) (int64, error) {
+	return UpdateDbContext[T](ctx, db, obj)
+}
+
+// UpdatePtr is Update for the object obj points to. The incremented version of types with a version column
+// is written into the object.
+func UpdatePtr[T Repo](obj *T) (int64, error) {
+	return UpdatePtrDb[T](db, obj)
+}
+
+// UpdatePtrContext is UpdatePtr with a context.
+func UpdatePtrContext[T Repo](ctx context.Context, obj *T) (int64, error) {
+	return UpdatePtrDbContext[T](ctx, db, obj)
+}
+
+// UpdateColumns updates only the given columns of the row in the table that the Repo type maps to.
+func UpdateColumns[T Repo](obj T, cols ...string) (int64, error) {
+	return UpdateColumnsDb[T](db, obj, cols...)
+}
+
+// UpdateColumnsContext is UpdateColumns with a context.
+func UpdateColumnsContext[T Repo](ctx context.Context, obj T, cols ...string) (int64, error) {
+	return UpdateColumnsDbContext[T](ctx, db, obj, cols...)
+}
+
+// UpdateColumnsPtr is UpdateColumns for the object obj points to. The incremented version of types with a version
+// column is written into the object.
+func UpdateColumnsPtr[T Repo](obj *T, cols ...string) (int64, error) {
+	return UpdateColumnsPtrDb[T](db, obj, cols...)
+}
+
+// UpdateColumnsPtrContext is UpdateColumnsPtr with a context.
+func UpdateColumnsPtrContext[T Repo](ctx context.Context, obj *T, cols ...string) (int64, error) {
+	return UpdateColumnsPtrDbContext[T](ctx, db, obj, cols...)
+}
+
+// Save updates the columns of obj that changed since the snapshot was taken using sqlpdb.TakeSnapshot.
+// If nothing changed, no statement is run and false is returned.
+func Save[T Repo](snap *Snapshot[T], obj T) (bool, error) {
+	return SaveDb[T](db, snap, obj)
+}
+
+// SaveContext is Save with a context.
+func SaveContext[T Repo](ctx context.Context, snap *Snapshot[T], obj T) (bool, error) {
+	return SaveDbContext[T](ctx, db, snap, obj)
+}
+
 // DeleteObj deletes the row in the table that the Repo type maps to based on the primary key of the given object.
-func DeleteObj[T Repo](obj T) error {
+func DeleteObj[T Repo](obj T) (int64, error) {
 	return DeleteDb[T](db, obj)
 }
 
-// Delete deletes the row in the table that the Repo type maps to based on the given primary key.
-func Delete[T Repo](pk any) error {
+// DeleteObjContext is DeleteObj with a context.
+func DeleteObjContext[T Repo](ctx context.Context, obj T) (int64, error) {
+	return DeleteDbContext[T](ctx, db, obj)
+}
+
+// Delete deletes the row in the table that the Repo type maps to based on the given primary key and returns the
+// number of affected rows. Use RequireAffected to get ErrNotFound if the row does not exist.
+func Delete[T Repo](pk any) (int64, error) {
 	return DeletePkDb[T](db, pk)
 }
+
+// DeleteContext is Delete with a context.
+func DeleteContext[T Repo](ctx context.Context, pk any) (int64, error) {
+	return DeletePkDbContext[T](ctx, db, pk)
+}
+
+// DeletePks deletes the row in the table that the Repo type maps to based on the given composite primary key.
+// The key parts must be given in the order of the primary key fields in the struct.
+func DeletePks[T Repo](pks ...any) (int64, error) {
+	return DeletePksDb[T](db, pks...)
+}
+
+// DeletePksContext is DeletePks with a context.
+func DeletePksContext[T Repo](ctx context.Context, pks ...any) (int64, error) {
+	return DeletePksDbContext[T](ctx, db, pks...)
+}
+
+// DeleteKey is Delete with a typed primary key, which must match the type of the primary key field.
+func DeleteKey[T Repo, K comparable](pk K) (int64, error) {
+	return DeleteKeyDb[T, K](db, pk)
+}
+
+// DeleteKeyContext is DeleteKey with a context.
+func DeleteKeyContext[T Repo, K comparable](ctx context.Context, pk K) (int64, error) {
+	return DeleteKeyDbContext[T, K](ctx, db, pk)
+}
@@ -0,0 +1,124 @@
+package sqlp
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+)
+
+// fakeDb is an in-memory database/sql driver which records all statements and answers queries
+// with the rows returned by the result function.
+type fakeDb struct {
+	mu      sync.Mutex
+	queries []string
+	args    [][]driver.Value
+
+	// result returns the columns and rows for a query. Nil returns no rows.
+	result func(query string, args []driver.Value) ([]string, [][]driver.Value)
+
+	// onNext is called before every row is returned
+	onNext func(row int)
+
+	lastInsertId int64
+	rowsAffected int64
+
+	// closed counts the closed result sets
+	closed int
+}
+
+func newFakeDb() (*fakeDb, *sql.DB) {
+	f := &fakeDb{rowsAffected: 1}
+	return f, sql.OpenDB(f)
+}
+
+func (f *fakeDb) record(query string, args []driver.NamedValue) []driver.Value {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	vals := make([]driver.Value, len(args))
+	for i, a := range args {
+		vals[i] = a.Value
+	}
+	f.queries = append(f.queries, query)
+	f.args = append(f.args, vals)
+	return vals
+}
+
+func (f *fakeDb) last() (string, []driver.Value) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.queries) == 0 {
+		return "", nil
+	}
+	return f.queries[len(f.queries)-1], f.args[len(f.args)-1]
+}
+
+func (f *fakeDb) all() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return strings.Join(f.queries, "; ")
+}
+
+func (f *fakeDb) Connect(context.Context) (driver.Conn, error) { return &fakeConn{f}, nil }
+func (f *fakeDb) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDb }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.record("BEGIN", nil)
+	return fakeTx{c.db}, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.record(query, args)
+	return fakeResult{c.db.lastInsertId, c.db.rowsAffected}, nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	vals := c.db.record(query, args)
+	r := &fakeRows{db: c.db}
+	if c.db.result != nil {
+		r.cols, r.rows = c.db.result(query, vals)
+	}
+	return r, nil
+}
+
+type fakeTx struct{ db *fakeDb }
+
+func (t fakeTx) Commit() error   { t.db.record("COMMIT", nil); return nil }
+func (t fakeTx) Rollback() error { t.db.record("ROLLBACK", nil); return nil }
+
+type fakeResult struct{ id, affected int64 }
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.id, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+type fakeRows struct {
+	db   *fakeDb
+	cols []string
+	rows [][]driver.Value
+	pos  int
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	r.db.closed++
+	return nil
+}
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	if r.db.onNext != nil {
+		r.db.onNext(r.pos)
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
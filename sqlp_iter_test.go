@@ -0,0 +1,41 @@
+//go:build go1.23
+
+package sqlp
+
+import (
+	"database/sql/driver"
+	. "github.com/ByteSizedMarius/sqlp/sqlpdb"
+	"testing"
+)
+
+func TestQueryIter(t *testing.T) {
+	f, sqldb := newFakeDb()
+	f.result = func(string, []driver.Value) ([]string, [][]driver.Value) {
+		return []string{"id", "name"}, [][]driver.Value{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"}}
+	}
+
+	var ids []int
+	for u, err := range GetIterRdb[ctxUser](sqldb) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, u.ID)
+		if u.ID == 2 {
+			break
+		}
+	}
+	if len(ids) != 2 {
+		t.Errorf("expected 2 rows got %v", ids)
+	}
+	if f.closed != 1 {
+		t.Errorf("expected rows to be closed after break got %d", f.closed)
+	}
+
+	var errs []error
+	for _, err := range QueryIterDb[ctxUser](nil, "SELECT * FROM users") {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || errs[0] != ErrNotSet {
+		t.Errorf("expected ErrNotSet got %v", errs)
+	}
+}
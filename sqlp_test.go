@@ -5,10 +5,17 @@
 package sqlp
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	. "github.com/ByteSizedMarius/sqlp/sqlpdb"
+	"github.com/ByteSizedMarius/sqlp/sqlpdialect"
 	. "github.com/ByteSizedMarius/sqlp/sqlpin"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 type EmbeddedType struct {
@@ -222,3 +229,1300 @@ func TestDoInQuery(t *testing.T) {
 		t.Errorf("expected %v got %v", expectedArgs, actualArgs)
 	}
 }
+
+type ctxUser struct {
+	ID   int    `sql:"id" sql-auto:""`
+	Name string `sql:"name"`
+}
+
+func (ctxUser) TableName() string { return "users" }
+
+func TestQueryContextCancelled(t *testing.T) {
+	f, sqldb := newFakeDb()
+	f.result = func(string, []driver.Value) ([]string, [][]driver.Value) {
+		return []string{"id", "name"}, [][]driver.Value{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"}}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f.onNext = func(row int) {
+		if row == 1 {
+			cancel()
+		}
+	}
+
+	res, err := QueryDbContext[ctxUser](ctx, sqldb, "SELECT * FROM users")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled got %v", err)
+	}
+	if res != nil {
+		t.Errorf("expected no results got %v", res)
+	}
+
+	res, err = QueryDbContext[ctxUser](context.Background(), sqldb, "SELECT * FROM users")
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if len(res) != 3 || res[2].Name != "c" {
+		t.Errorf("unexpected results %v", res)
+	}
+}
+
+func TestQueryRowEmptyIn(t *testing.T) {
+	f, sqldb := newFakeDb()
+
+	if _, err := QueryRowDb[ctxUser](sqldb, "SELECT * FROM users WHERE id IN (*)"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows got %v", err)
+	}
+	if _, err := QueryBasicRowDb[int](sqldb, "SELECT id FROM users WHERE id IN (*)"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows got %v", err)
+	}
+	if n, err := CountRdb[ctxUser](sqldb, "WHERE id IN (*)"); err != nil || n != 0 {
+		t.Errorf("expected 0 got %d (%v)", n, err)
+	}
+	if len(f.queries) != 0 {
+		t.Errorf("expected no queries got %q", f.all())
+	}
+}
+
+func TestInsertInTx(t *testing.T) {
+	f, sqldb := newFakeDb()
+	f.lastInsertId = 7
+
+	tx, err := sqldb.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := InsertDbContext(context.Background(), tx, ctxUser{Name: "a"})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if id != 7 {
+		t.Errorf("expected id 7 got %d", id)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "BEGIN; INSERT INTO users (name) VALUES (?); COMMIT"
+	if f.all() != expected {
+		t.Errorf("expected %q got %q", expected, f.all())
+	}
+
+	var unset *sql.DB
+	if _, err = InsertDb(unset, ctxUser{}); !errors.Is(err, ErrNotSet) {
+		t.Errorf("expected ErrNotSet got %v", err)
+	}
+	if _, err = UpdateDb(unset, ctxUser{ID: 1}); !errors.Is(err, ErrNotSet) {
+		t.Errorf("expected ErrNotSet got %v", err)
+	}
+}
+
+func TestWithTxNested(t *testing.T) {
+	f, sqldb := newFakeDb()
+	ctx := context.Background()
+	errInner := errors.New("inner")
+
+	err := WithTx(ctx, sqldb, func(tx *Tx) error {
+		if _, err := InsertDbContext(ctx, tx, ctxUser{Name: "a"}); err != nil {
+			return err
+		}
+		if err := WithTx(ctx, tx, func(tx *Tx) error { return errInner }); !errors.Is(err, errInner) {
+			t.Errorf("expected inner error got %v", err)
+		}
+		return WithTx(ctx, tx, func(tx *Tx) error { return nil })
+	})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	expected := "BEGIN; INSERT INTO users (name) VALUES (?); SAVEPOINT sqlp_sp_1; ROLLBACK TO SAVEPOINT sqlp_sp_1; " +
+		"SAVEPOINT sqlp_sp_1; RELEASE SAVEPOINT sqlp_sp_1; COMMIT"
+	if f.all() != expected {
+		t.Errorf("expected %q got %q", expected, f.all())
+	}
+
+	f, sqldb = newFakeDb()
+	RegisterDialect(sqldb, sqlpdialect.SQLServer)
+	defer RegisterDialect(sqldb, nil)
+
+	err = WithTx(ctx, sqldb, func(tx *Tx) error {
+		_ = WithTx(ctx, tx, func(tx *Tx) error { return errInner })
+		return WithTx(ctx, tx, func(tx *Tx) error { return nil })
+	})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	expected = "BEGIN; SAVE TRANSACTION sqlp_sp_1; ROLLBACK TRANSACTION sqlp_sp_1; SAVE TRANSACTION sqlp_sp_1; COMMIT"
+	if f.all() != expected {
+		t.Errorf("expected %q got %q", expected, f.all())
+	}
+}
+
+func TestWithTxPanic(t *testing.T) {
+	f, sqldb := newFakeDb()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic to be re-raised")
+		}
+		if f.all() != "BEGIN; ROLLBACK" {
+			t.Errorf("expected rollback got %q", f.all())
+		}
+	}()
+
+	_ = WithTx(context.Background(), sqldb, func(tx *Tx) error { panic("boom") })
+}
+
+func TestRebind(t *testing.T) {
+	query := "SELECT * FROM users WHERE name = '?' AND id = ? AND age > ?"
+	expected := "SELECT * FROM users WHERE name = '?' AND id = $1 AND age > $2"
+	if actual := sqlpdialect.Rebind(sqlpdialect.Postgres, query); actual != expected {
+		t.Errorf("expected %q got %q", expected, actual)
+	}
+
+	expected = "SELECT * FROM users WHERE name = '?' AND id = @p1 AND age > @p2"
+	if actual := sqlpdialect.Rebind(sqlpdialect.SQLServer, query); actual != expected {
+		t.Errorf("expected %q got %q", expected, actual)
+	}
+
+	if actual := sqlpdialect.Rebind(sqlpdialect.MySQL, query); actual != query {
+		t.Errorf("expected %q got %q", query, actual)
+	}
+}
+
+func TestDoInQueryEmpty(t *testing.T) {
+	query := "DELETE FROM table WHERE id IN (*)"
+	expectedQuery := "DELETE FROM table WHERE id IN (NULL)"
+
+	actualQuery, _, err := InQuery(query, []any{[]int{}})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if actualQuery != expectedQuery {
+		t.Errorf("expected %q got %q", expectedQuery, actualQuery)
+	}
+
+	// an empty NOT IN list matches every row, so the comparison is replaced
+	tests := []struct {
+		d     sqlpdialect.Dialect
+		query string
+		args  []any
+		want  string
+	}{
+		{sqlpdialect.Generic, "DELETE FROM table WHERE id NOT IN (*)", []any{[]int{}}, "DELETE FROM table WHERE TRUE = TRUE"},
+		{sqlpdialect.SQLServer, "SELECT * FROM t WHERE a = ? AND lower([t].[name]) not IN (*) AND b = ?", []any{1, []string{}, 2}, "SELECT * FROM t WHERE a = ? AND 1 = 1 AND b = ?"},
+		{sqlpdialect.Postgres, `SELECT * FROM t WHERE "t"."id" NOT IN (*)`, nil, "SELECT * FROM t WHERE TRUE = TRUE"},
+	}
+	for _, tt := range tests {
+		q, args, err := InQueryDialect(tt.d, tt.query, tt.args)
+		if err != nil || q != tt.want {
+			t.Errorf("expected %q got %q (%v)", tt.want, q, err)
+		}
+		if len(tt.args) == 3 && !reflect.DeepEqual(args, []any{1, 2}) {
+			t.Errorf("unexpected args %v", args)
+		}
+	}
+
+	if _, _, err = InQuery("SELECT * FROM t WHERE coalesce(a, ?) NOT IN (*)", []any{0, []int{}}); err == nil {
+		t.Error("expected error for operand with placeholder")
+	}
+}
+
+func TestDialectStatements(t *testing.T) {
+	f, sqldb := newFakeDb()
+	RegisterDialect(sqldb, sqlpdialect.Postgres)
+	defer RegisterDialect(sqldb, nil)
+	ctx := context.Background()
+
+	if _, err := UpdateDb(sqldb, ctxUser{ID: 1, Name: "a"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	expected := `UPDATE "users" SET "name"=$1 WHERE "id"=$2`
+	if q, _ := f.last(); q != expected {
+		t.Errorf("expected %q got %q", expected, q)
+	}
+
+	if _, err := DeletePkDb[ctxUser](sqldb, 1); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	expected = `DELETE FROM "users" WHERE "id"=$1`
+	if q, _ := f.last(); q != expected {
+		t.Errorf("expected %q got %q", expected, q)
+	}
+
+	// transactions started by WithTx inherit the dialect
+	err := WithTx(ctx, sqldb, func(tx *Tx) error {
+		_, err := QueryDbContext[ctxUser](ctx, tx, "SELECT * FROM users WHERE id IN (*) AND name = ?", []int{1, 2}, "a")
+		return err
+	})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	expected = `SELECT "id", "name" FROM users WHERE id IN ($1, $2) AND name = $3`
+	if q := f.queries[len(f.queries)-2]; q != expected {
+		t.Errorf("expected %q got %q", expected, q)
+	}
+}
+
+func TestInsertReturningKey(t *testing.T) {
+	f, sqldb := newFakeDb()
+	defer RegisterDialect(sqldb, nil)
+	f.result = func(string, []driver.Value) ([]string, [][]driver.Value) {
+		return []string{"id"}, [][]driver.Value{{int64(42)}}
+	}
+
+	tests := []struct {
+		dialect  sqlpdialect.Dialect
+		expected string
+	}{
+		{sqlpdialect.Postgres, `INSERT INTO "users" ("name") VALUES ($1) RETURNING "id"`},
+		{sqlpdialect.SQLServer, `INSERT INTO [users] ([name]) OUTPUT INSERTED.[id] VALUES (@p1)`},
+		{sqlpdialect.WithKeyRetrieval(sqlpdialect.SQLite, sqlpdialect.Returning), `INSERT INTO "users" ("name") VALUES (?) RETURNING "id"`},
+	}
+
+	for _, tt := range tests {
+		RegisterDialect(sqldb, tt.dialect)
+		id, err := InsertDb(sqldb, ctxUser{Name: "a"})
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if id != 42 {
+			t.Errorf("expected id 42 got %d", id)
+		}
+		if q, _ := f.last(); q != tt.expected {
+			t.Errorf("expected %q got %q", tt.expected, q)
+		}
+	}
+}
+
+func TestInsertPtr(t *testing.T) {
+	f, sqldb := newFakeDb()
+	f.lastInsertId = 3
+
+	u := ctxUser{Name: "a"}
+	if err := InsertPtrDb(sqldb, &u); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if u.ID != 3 {
+		t.Errorf("expected id 3 got %d", u.ID)
+	}
+
+	// without RETURNING, the row is read again using the primary key
+	f.result = func(string, []driver.Value) ([]string, [][]driver.Value) {
+		return []string{"id", "name"}, [][]driver.Value{{int64(3), "default"}}
+	}
+	u = ctxUser{}
+	if err := InsertReturningDb(sqldb, &u); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if u.ID != 3 || u.Name != "default" {
+		t.Errorf("unexpected object %v", u)
+	}
+	q, args := f.last()
+	if q != "SELECT id, name FROM users WHERE id=?" || !reflect.DeepEqual(args, []driver.Value{int64(3)}) {
+		t.Errorf("unexpected query %q %v", q, args)
+	}
+
+	// with RETURNING, all columns are returned by the insert
+	RegisterDialect(sqldb, sqlpdialect.Postgres)
+	defer RegisterDialect(sqldb, nil)
+	u = ctxUser{}
+	if err := InsertReturningDb(sqldb, &u); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if u.ID != 3 || u.Name != "default" {
+		t.Errorf("unexpected object %v", u)
+	}
+	expected := `INSERT INTO "users" ("name") VALUES ($1) RETURNING "id", "name"`
+	if q, _ := f.last(); q != expected {
+		t.Errorf("expected %q got %q", expected, q)
+	}
+}
+
+type uuidUser struct {
+	ID   string `sql:"id" sql-auto:""`
+	Name string `sql:"name"`
+}
+
+func (uuidUser) TableName() string { return "uuid_users" }
+
+func TestTypedKeys(t *testing.T) {
+	f, sqldb := newFakeDb()
+	RegisterDialect(sqldb, sqlpdialect.Postgres)
+	defer RegisterDialect(sqldb, nil)
+	f.result = func(string, []driver.Value) ([]string, [][]driver.Value) {
+		return []string{"id"}, [][]driver.Value{{"0b5e6f1c"}}
+	}
+
+	id, err := InsertKeyDb[uuidUser, string](sqldb, uuidUser{Name: "a"})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if id != "0b5e6f1c" {
+		t.Errorf("expected generated key got %q", id)
+	}
+
+	n := len(f.queries)
+	if _, err = InsertKeyDb[uuidUser, int](sqldb, uuidUser{}); err == nil {
+		t.Errorf("expected error for mismatched key type")
+	}
+	if _, err = GetPkDb[uuidUser](sqldb, 5); err == nil {
+		t.Errorf("expected error for mismatched key type")
+	}
+	if len(f.queries) != n {
+		t.Errorf("expected no queries to be run, got %q", f.queries[n:])
+	}
+
+	// integer keys are compatible with each other
+	f.result = func(string, []driver.Value) ([]string, [][]driver.Value) {
+		return []string{"id"}, [][]driver.Value{{int64(9)}}
+	}
+	id64, err := InsertKeyDb[ctxUser, int64](sqldb, ctxUser{})
+	if err != nil || id64 != 9 {
+		t.Errorf("expected key 9 got %d (%v)", id64, err)
+	}
+	if _, err = GetKeyDb[ctxUser](sqldb, int64(9)); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+type membership struct {
+	UserID  int    `sql:"user_id,pk"`
+	GroupID int    `sql:"group_id,pk"`
+	Role    string `sql:"role"`
+}
+
+func (membership) TableName() string { return "memberships" }
+
+func TestCompositePk(t *testing.T) {
+	f, sqldb := newFakeDb()
+	m := membership{UserID: 1, GroupID: 2, Role: "admin"}
+
+	// the key columns are inserted, composite keys are not returned
+	if id, err := InsertDb(sqldb, m); err != nil || id != 0 {
+		t.Errorf("expected 0 got %d (%v)", id, err)
+	}
+	q, args := f.last()
+	if q != "INSERT INTO memberships (user_id, group_id, role) VALUES (?, ?, ?)" || !reflect.DeepEqual(args, []driver.Value{int64(1), int64(2), "admin"}) {
+		t.Errorf("unexpected query %q %v", q, args)
+	}
+
+	if _, err := UpdateDb(sqldb, m); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	q, args = f.last()
+	if q != "UPDATE memberships SET role=? WHERE user_id=? AND group_id=?" || !reflect.DeepEqual(args, []driver.Value{"admin", int64(1), int64(2)}) {
+		t.Errorf("unexpected query %q %v", q, args)
+	}
+
+	if _, err := DeleteDb(sqldb, m); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	q, args = f.last()
+	if q != "DELETE FROM memberships WHERE user_id=? AND group_id=?" || !reflect.DeepEqual(args, []driver.Value{int64(1), int64(2)}) {
+		t.Errorf("unexpected query %q %v", q, args)
+	}
+
+	if _, err := GetPksDb[membership](sqldb, 1, 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows got %v", err)
+	}
+	if q, _ = f.last(); q != "SELECT group_id, role, user_id FROM memberships WHERE user_id=? AND group_id=?" {
+		t.Errorf("unexpected query %q", q)
+	}
+
+	if _, err := GetPkDb[membership](sqldb, 1); err == nil {
+		t.Errorf("expected error for incomplete composite key")
+	}
+}
+
+type country struct {
+	Code string `sql:"code" sql-pk:""`
+	Name string `sql:"name"`
+}
+
+func (country) TableName() string { return "countries" }
+
+func TestApplicationAssignedPk(t *testing.T) {
+	f, sqldb := newFakeDb()
+
+	code, err := InsertKeyDb[country, string](sqldb, country{Code: "de", Name: "Germany"})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if code != "de" {
+		t.Errorf("expected key de got %q", code)
+	}
+	q, args := f.last()
+	if q != "INSERT INTO countries (code, name) VALUES (?, ?)" {
+		t.Errorf("unexpected query %q %v", q, args)
+	}
+
+	// Insert returns 0 for keys which are not integers, after inserting the row
+	n := len(f.queries)
+	if id, err := InsertDb(sqldb, country{Code: "fr", Name: "France"}); err != nil || id != 0 {
+		t.Errorf("expected 0 got %d (%v)", id, err)
+	}
+	if len(f.queries) != n+1 {
+		t.Errorf("expected the row to be inserted")
+	}
+
+	if _, err = UpdateDb(sqldb, country{Code: "de", Name: "Deutschland"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if q, _ = f.last(); q != "UPDATE countries SET name=? WHERE code=?" {
+		t.Errorf("unexpected query %q", q)
+	}
+}
+
+type taggedUser struct {
+	ID       int64  `sql:"id,pk,auto"`
+	Email    string `sql:"email,insertonly"`
+	Name     string `sql:",omitempty"`
+	Score    int    `sql:"score,readonly"`
+	Password string `sql:"password" sql-ign-edit:""`
+}
+
+func (taggedUser) TableName() string { return "tagged_users" }
+
+func TestTagOptions(t *testing.T) {
+	f, sqldb := newFakeDb()
+	f.lastInsertId = 5
+
+	u := taggedUser{Email: "a@b.c", Password: "x"}
+	if err := InsertPtrDb(sqldb, &u); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if u.ID != 5 {
+		t.Errorf("expected id 5 got %d", u.ID)
+	}
+	q, args := f.last()
+	if q != "INSERT INTO tagged_users (email, password) VALUES (?, ?)" || !reflect.DeepEqual(args, []driver.Value{"a@b.c", "x"}) {
+		t.Errorf("unexpected query %q %v", q, args)
+	}
+
+	u.Name = "a"
+	if err := InsertPtrDb(sqldb, &u); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if q, _ = f.last(); q != "INSERT INTO tagged_users (email, name, password) VALUES (?, ?, ?)" {
+		t.Errorf("unexpected query %q", q)
+	}
+
+	if _, err := UpdateDb(sqldb, u); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if q, _ = f.last(); q != "UPDATE tagged_users SET name=? WHERE id=?" {
+		t.Errorf("unexpected query %q", q)
+	}
+
+	if _, err := QueryDb[taggedUser](sqldb, "SELECT * FROM tagged_users"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if q, _ = f.last(); q != "SELECT email, id, name, password, score FROM tagged_users" {
+		t.Errorf("unexpected query %q", q)
+	}
+
+	// unknown options are reported before a statement is run
+	n := len(f.queries)
+	if _, err := InsertDb(sqldb, misspelledTag{}); err == nil || !strings.Contains(err.Error(), `unknown option "primary"`) {
+		t.Errorf("expected error for unknown option got %v", err)
+	}
+	if len(f.queries) != n {
+		t.Errorf("expected no query got %q", f.queries[n:])
+	}
+}
+
+type misspelledTag struct {
+	ID int `sql:"id,primary"`
+}
+
+func (misspelledTag) TableName() string { return "misspelled" }
+
+func TestInsertMany(t *testing.T) {
+	f, sqldb := newFakeDb()
+	RegisterDialect(sqldb, limitDialect{sqlpdialect.Postgres, 4})
+	defer RegisterDialect(sqldb, nil)
+
+	next := int64(0)
+	f.result = func(_ string, args []driver.Value) ([]string, [][]driver.Value) {
+		var rows [][]driver.Value
+		for range args {
+			next++
+			rows = append(rows, []driver.Value{next})
+		}
+		return []string{"id"}, rows
+	}
+
+	users := []ctxUser{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}, {Name: "e"}}
+	if err := InsertManyDb(sqldb, users); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := `INSERT INTO "users" ("name") VALUES ($1), ($2), ($3), ($4) RETURNING "id"; ` +
+		`INSERT INTO "users" ("name") VALUES ($1) RETURNING "id"`
+	if f.all() != expected {
+		t.Errorf("expected %q got %q", expected, f.all())
+	}
+	for i, u := range users {
+		if u.ID != i+1 {
+			t.Errorf("expected id %d got %d", i+1, u.ID)
+		}
+	}
+
+	// SQL Server allows at most 1000 rows per statement
+	RegisterDialect(sqldb, sqlpdialect.SQLServer)
+	n := len(f.queries)
+	if err := InsertManyDb(sqldb, make([]ctxUser, 1500)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(f.queries) != n+2 || strings.Count(f.queries[n], "(@p") != 1000 {
+		t.Errorf("expected chunks of 1000 rows got %d statements", len(f.queries)-n)
+	}
+
+	RegisterDialect(sqldb, sqlpdialect.Oracle)
+	n = len(f.queries)
+	if err := InsertManyDb(sqldb, users); !errors.Is(err, sqlpdialect.ErrUnsupported) || len(f.queries) != n {
+		t.Errorf("expected ErrUnsupported got %v", err)
+	}
+}
+
+// limitDialect overrides the parameter limit of a dialect
+type limitDialect struct {
+	sqlpdialect.Dialect
+	max int
+}
+
+func (d limitDialect) MaxParams() int { return d.max }
+
+func TestUpsert(t *testing.T) {
+	f, sqldb := newFakeDb()
+	defer RegisterDialect(sqldb, nil)
+	c := country{Code: "de", Name: "Germany"}
+
+	if err := UpsertDb(sqldb, c, UpsertOptions{}); !errors.Is(err, sqlpdialect.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported got %v", err)
+	}
+
+	tests := []struct {
+		dialect  sqlpdialect.Dialect
+		opts     UpsertOptions
+		expected string
+	}{
+		{sqlpdialect.Postgres, UpsertOptions{}, `INSERT INTO "countries" ("code", "name") VALUES ($1, $2) ON CONFLICT ("code") DO UPDATE SET "name"=excluded."name"`},
+		{sqlpdialect.SQLite, UpsertOptions{DoNothing: true}, `INSERT INTO "countries" ("code", "name") VALUES (?, ?) ON CONFLICT ("code") DO NOTHING`},
+		{sqlpdialect.MySQL, UpsertOptions{Update: []string{"name"}}, "INSERT INTO `countries` (`code`, `name`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `name`=VALUES(`name`)"},
+	}
+	for _, tt := range tests {
+		RegisterDialect(sqldb, tt.dialect)
+		if err := UpsertDb(sqldb, c, tt.opts); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if q, _ := f.last(); q != tt.expected {
+			t.Errorf("expected %q got %q", tt.expected, q)
+		}
+	}
+
+	if err := UpsertDb(sqldb, c, UpsertOptions{Conflict: []string{"nope"}}); err == nil {
+		t.Errorf("expected error for unknown conflict column")
+	}
+
+	// a set generated key is inserted to conflict with the existing row
+	RegisterDialect(sqldb, sqlpdialect.Postgres)
+	if err := UpsertDb(sqldb, ctxUser{ID: 5, Name: "x"}, UpsertOptions{}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	q, args := f.last()
+	if q != `INSERT INTO "users" ("id", "name") VALUES ($1, $2) ON CONFLICT ("id") DO UPDATE SET "name"=excluded."name"` || !reflect.DeepEqual(args, []driver.Value{int64(5), "x"}) {
+		t.Errorf("unexpected query %q %v", q, args)
+	}
+
+	// without a key, the row can not conflict with the primary key
+	n := len(f.queries)
+	if err := UpsertDb(sqldb, ctxUser{Name: "x"}, UpsertOptions{}); err == nil {
+		t.Errorf("expected error for conflict column which is not inserted")
+	}
+	if len(f.queries) != n {
+		t.Errorf("expected no query got %q", f.queries[n:])
+	}
+}
+
+func TestUpdateColumns(t *testing.T) {
+	f, sqldb := newFakeDb()
+	u := taggedUser{ID: 1, Name: "a", Password: "x"}
+
+	if _, err := UpdateColumnsDb(sqldb, u, "name"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	q, args := f.last()
+	if q != "UPDATE tagged_users SET name=? WHERE id=?" || !reflect.DeepEqual(args, []driver.Value{"a", int64(1)}) {
+		t.Errorf("unexpected query %q %v", q, args)
+	}
+
+	for _, col := range []string{"unknown", "email", "id", "score", "password"} {
+		if _, err := UpdateColumnsDb(sqldb, u, col); err == nil {
+			t.Errorf("expected error for column %q", col)
+		}
+	}
+}
+
+type document struct {
+	ID      int    `sql:"id,pk,auto"`
+	Title   string `sql:"title"`
+	Content []byte `sql:"content"`
+	Tag     *string
+}
+
+func (document) TableName() string { return "documents" }
+
+func TestSnapshotSave(t *testing.T) {
+	f, sqldb := newFakeDb()
+	tag := "a"
+	d := document{ID: 1, Title: "t", Content: []byte("abc"), Tag: &tag}
+	snap := TakeSnapshot(d)
+
+	changed, err := SaveDb(sqldb, snap, d)
+	if err != nil || changed {
+		t.Errorf("expected no change got %t (%v)", changed, err)
+	}
+	if len(f.queries) != 0 {
+		t.Errorf("expected no queries got %q", f.all())
+	}
+
+	// modifications in place are detected
+	d.Content[0] = 'x'
+	tag = "b"
+	if c := snap.Changed(d); !reflect.DeepEqual(c, []string{"content", "tag"}) {
+		t.Errorf("unexpected changed columns %v", c)
+	}
+
+	changed, err = SaveDb(sqldb, snap, d)
+	if err != nil || !changed {
+		t.Errorf("expected change got %t (%v)", changed, err)
+	}
+	if q, _ := f.last(); q != "UPDATE documents SET content=?, tag=? WHERE id=?" {
+		t.Errorf("unexpected query %q", q)
+	}
+
+	// the snapshot is updated after saving
+	if c := snap.Changed(d); len(c) != 0 {
+		t.Errorf("expected no changed columns got %v", c)
+	}
+}
+
+func TestRowsAffected(t *testing.T) {
+	f, sqldb := newFakeDb()
+	f.rowsAffected = 2
+
+	n, err := UpdateDb(sqldb, ctxUser{ID: 1, Name: "a"})
+	if err != nil || n != 2 {
+		t.Errorf("expected 2 rows affected got %d (%v)", n, err)
+	}
+
+	f.rowsAffected = 0
+	if err = RequireAffected(DeletePkDb[ctxUser](sqldb, 1)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound got %v", err)
+	}
+	if err = RequireAffected(UpdateDb(sqldb, ctxUser{ID: 1, Name: "a"})); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound got %v", err)
+	}
+
+	d := document{ID: 1, Title: "t"}
+	snap := TakeSnapshot(d)
+	d.Title = "u"
+	if _, err = SaveDb(sqldb, snap, d); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound got %v", err)
+	}
+}
+
+type article struct {
+	ID      int    `sql:"id,pk,auto"`
+	Title   string `sql:"title"`
+	Version int64  `sql:"version,version"`
+}
+
+func (article) TableName() string { return "articles" }
+
+func TestOptimisticLocking(t *testing.T) {
+	f, sqldb := newFakeDb()
+	a := article{ID: 1, Title: "t", Version: 3}
+
+	if _, err := UpdatePtrDb(sqldb, &a); err != nil {
+		t.Fatal(err)
+	}
+	q, args := f.last()
+	if q != "UPDATE articles SET title=?, version=version+1 WHERE id=? AND version=?" {
+		t.Errorf("unexpected query %q", q)
+	}
+	if !reflect.DeepEqual(args, []driver.Value{"t", int64(1), int64(3)}) {
+		t.Errorf("unexpected args %v", args)
+	}
+	if a.Version != 4 {
+		t.Errorf("expected version 4 got %d", a.Version)
+	}
+
+	// the version column can not be updated directly
+	if _, err := UpdateColumnsDb(sqldb, a, "version"); err == nil {
+		t.Error("expected error updating the version column")
+	}
+
+	if _, err := UpdateColumnsPtrDb(sqldb, &a, "title"); err != nil {
+		t.Fatal(err)
+	}
+	if _, args = f.last(); !reflect.DeepEqual(args, []driver.Value{"t", int64(1), int64(4)}) || a.Version != 5 {
+		t.Errorf("unexpected args %v and version %d", args, a.Version)
+	}
+
+	f.rowsAffected = 0
+	if _, err := UpdatePtrDb(sqldb, &a); !errors.Is(err, ErrStaleObject) {
+		t.Errorf("expected ErrStaleObject got %v", err)
+	}
+	if a.Version != 5 {
+		t.Errorf("expected version to be unchanged got %d", a.Version)
+	}
+}
+
+type post struct {
+	ID        int        `sql:"id,pk,auto"`
+	Title     string     `sql:"title"`
+	DeletedAt *time.Time `sql:"deleted_at,softdelete"`
+}
+
+func (post) TableName() string { return "posts" }
+
+func TestSoftDelete(t *testing.T) {
+	f, sqldb := newFakeDb()
+	ctx := context.Background()
+
+	if _, err := DeletePkDb[post](sqldb, 1); err != nil {
+		t.Fatal(err)
+	}
+	q, args := f.last()
+	if q != "UPDATE posts SET deleted_at=? WHERE id=? AND deleted_at IS NULL" || len(args) != 2 {
+		t.Errorf("unexpected query %q %v", q, args)
+	}
+	if _, ok := args[0].(time.Time); !ok {
+		t.Errorf("expected deletion time got %T", args[0])
+	}
+
+	if _, err := DeletePkDbContext[post](HardDelete(ctx), sqldb, 1); err != nil {
+		t.Fatal(err)
+	}
+	if q, _ = f.last(); q != "DELETE FROM posts WHERE id=?" {
+		t.Errorf("unexpected query %q", q)
+	}
+
+	tests := []struct {
+		ctx   context.Context
+		query string
+	}{
+		{ctx, "SELECT deleted_at, id, title FROM (SELECT * FROM posts WHERE deleted_at IS NULL) posts WHERE id=?"},
+		{WithDeleted(ctx), "SELECT deleted_at, id, title FROM posts WHERE id=?"},
+		{OnlyDeleted(ctx), "SELECT deleted_at, id, title FROM (SELECT * FROM posts WHERE deleted_at IS NOT NULL) posts WHERE id=?"},
+	}
+	for _, tt := range tests {
+		_, _ = GetPkDbContext[post](tt.ctx, sqldb, 1)
+		if q, _ = f.last(); q != tt.query {
+			t.Errorf("unexpected query %q", q)
+		}
+	}
+
+	if _, err := GetWhereRdb[post](sqldb, "ORDER BY title"); err != nil {
+		t.Fatal(err)
+	}
+	if q, _ = f.last(); q != "SELECT deleted_at, id, title FROM (SELECT * FROM posts WHERE deleted_at IS NULL) posts ORDER BY title" {
+		t.Errorf("unexpected query %q", q)
+	}
+
+	// the soft-delete column is not written by inserts and updates
+	if _, err := InsertDb(sqldb, post{Title: "t"}); err != nil {
+		t.Fatal(err)
+	}
+	if q, _ = f.last(); q != "INSERT INTO posts (title) VALUES (?)" {
+		t.Errorf("unexpected query %q", q)
+	}
+	if _, err := UpdateDb(sqldb, post{ID: 1, Title: "t"}); err != nil {
+		t.Fatal(err)
+	}
+	if q, _ = f.last(); q != "UPDATE posts SET title=? WHERE id=?" {
+		t.Errorf("unexpected query %q", q)
+	}
+
+	// the soft-delete column must be nullable
+	if _, err := GetRdb[zeroPost](sqldb); err == nil {
+		t.Error("expected error for soft-delete column which is not nullable")
+	}
+
+	// qualified tables are aliased with the table name only
+	RegisterDialect(sqldb, sqlpdialect.Postgres)
+	defer RegisterDialect(sqldb, nil)
+	if _, err := GetRdb[schemaPost](sqldb); err != nil {
+		t.Fatal(err)
+	}
+	if q, _ = f.last(); q != `SELECT "deleted_at", "id", "title" FROM (SELECT * FROM "app"."posts" WHERE "deleted_at" IS NULL) "posts"` {
+		t.Errorf("unexpected query %q", q)
+	}
+}
+
+type schemaPost struct {
+	ID        int        `sql:"id,pk,auto"`
+	Title     string     `sql:"title"`
+	DeletedAt *time.Time `sql:"deleted_at,softdelete"`
+}
+
+func (schemaPost) TableName() string { return "app.posts" }
+
+type zeroPost struct {
+	ID        int       `sql:"id,pk,auto"`
+	DeletedAt time.Time `sql:"deleted_at,softdelete"`
+}
+
+func (zeroPost) TableName() string { return "posts" }
+
+type event struct {
+	ID        int        `sql:"id,pk,auto"`
+	Name      string     `sql:"name"`
+	CreatedAt time.Time  `sql:"created_at,created"`
+	UpdatedAt *time.Time `sql:"updated_at,updated"`
+}
+
+func (event) TableName() string { return "events" }
+
+func TestTimestamps(t *testing.T) {
+	f, sqldb := newFakeDb()
+	f.lastInsertId = 1
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	defer func(clock func() time.Time) { Now = clock }(Now)
+	Now = func() time.Time { return now }
+
+	e := event{Name: "a"}
+	if err := InsertPtrDb(sqldb, &e); err != nil {
+		t.Fatal(err)
+	}
+	q, args := f.last()
+	if q != "INSERT INTO events (name, created_at, updated_at) VALUES (?, ?, ?)" || !reflect.DeepEqual(args, []driver.Value{"a", now, now}) {
+		t.Errorf("unexpected query %q %v", q, args)
+	}
+	if !e.CreatedAt.Equal(now) || e.UpdatedAt == nil || !e.UpdatedAt.Equal(now) {
+		t.Errorf("expected timestamps to be set got %v %v", e.CreatedAt, e.UpdatedAt)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := UpdateColumnsDb(sqldb, e, "name"); err != nil {
+		t.Fatal(err)
+	}
+	q, args = f.last()
+	if q != "UPDATE events SET name=?, updated_at=? WHERE id=?" || !reflect.DeepEqual(args, []driver.Value{"a", now, int64(1)}) {
+		t.Errorf("unexpected query %q %v", q, args)
+	}
+
+	// the created column is never updated
+	if _, err := UpdateColumnsDb(sqldb, e, "created_at"); err == nil {
+		t.Error("expected error updating the created column")
+	}
+
+	// the updated column does not count as a change
+	snap := TakeSnapshot(e)
+	e.UpdatedAt = nil
+	if c := snap.Changed(e); len(c) != 0 {
+		t.Errorf("expected no changed columns got %v", c)
+	}
+}
+
+type hookedUser struct {
+	ID   int    `sql:"id,pk,auto"`
+	Name string `sql:"name"`
+
+	calls []string
+}
+
+var errHook = errors.New("hook failed")
+
+func (hookedUser) TableName() string { return "users" }
+
+func (u *hookedUser) BeforeInsert(context.Context) error {
+	u.calls = append(u.calls, "BeforeInsert")
+	u.Name = strings.TrimSpace(u.Name)
+	return nil
+}
+
+func (u *hookedUser) AfterInsert(context.Context) error {
+	u.calls = append(u.calls, "AfterInsert")
+	return nil
+}
+
+func (u *hookedUser) BeforeUpdate(context.Context) error {
+	u.calls = append(u.calls, "BeforeUpdate")
+	if u.Name == "" {
+		return errHook
+	}
+	return nil
+}
+
+func (u *hookedUser) AfterUpdate(context.Context) error {
+	u.calls = append(u.calls, "AfterUpdate")
+	return nil
+}
+
+func (u *hookedUser) BeforeDelete(context.Context) error {
+	if u.ID == 0 {
+		return errHook
+	}
+	return nil
+}
+
+func (u *hookedUser) AfterScan(context.Context) error {
+	u.calls = append(u.calls, "AfterScan")
+	return nil
+}
+
+func TestHooks(t *testing.T) {
+	f, sqldb := newFakeDb()
+	f.lastInsertId = 1
+
+	u := hookedUser{Name: " a "}
+	if err := InsertPtrDb(sqldb, &u); err != nil {
+		t.Fatal(err)
+	}
+	if _, args := f.last(); !reflect.DeepEqual(args, []driver.Value{"a"}) {
+		t.Errorf("expected name to be normalized got %v", args)
+	}
+
+	if _, err := UpdatePtrDb(sqldb, &u); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(u.calls, []string{"BeforeInsert", "AfterInsert", "BeforeUpdate", "AfterUpdate"}) {
+		t.Errorf("unexpected hook calls %v", u.calls)
+	}
+
+	// errors of Before hooks abort the operation
+	n := len(f.queries)
+	if _, err := UpdateDb(sqldb, hookedUser{ID: 1}); !errors.Is(err, errHook) {
+		t.Errorf("expected hook error got %v", err)
+	}
+	if _, err := DeletePkDb[hookedUser](sqldb, 0); !errors.Is(err, errHook) {
+		t.Errorf("expected hook error got %v", err)
+	}
+	if len(f.queries) != n {
+		t.Errorf("expected no queries got %q", f.queries[n:])
+	}
+
+	// the hook is called with the primary key set
+	if _, err := DeletePkDb[hookedUser](sqldb, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	f.result = func(string, []driver.Value) ([]string, [][]driver.Value) {
+		return []string{"id", "name"}, [][]driver.Value{{int64(1), "a"}}
+	}
+	res, err := GetPkDb[hookedUser](sqldb, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.calls, []string{"AfterScan"}) {
+		t.Errorf("unexpected hook calls %v", res.calls)
+	}
+}
+
+type account struct {
+	ID     int     `sql:"id,pk,auto" sql-validate:"required"` // set by the database, not checked on insert
+	Name   string  `sql:"name" sql-validate:"required,maxlen=5"`
+	Age    int     `sql:"age" sql-validate:"min=18,max=130"`
+	Role   string  `sql:"role" sql-validate:"enum=admin|user"`
+	Handle *string `sql:"handle" sql-validate:"regex=^[a-z]{2,8}$"`
+}
+
+func (account) TableName() string { return "accounts" }
+
+func (a *account) Validate() error {
+	if a.Role == "admin" && a.Age < 21 {
+		return errHook
+	}
+	return nil
+}
+
+func TestValidation(t *testing.T) {
+	f, sqldb := newFakeDb()
+
+	handle := "A1"
+	_, err := InsertDb(sqldb, account{Name: "abcdef", Age: 17, Role: "guest", Handle: &handle})
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError got %v", err)
+	}
+	var failed []string
+	for _, c := range verr.Columns {
+		failed = append(failed, c.Column+":"+c.Constraint)
+	}
+	if want := []string{"name:maxlen", "age:min", "role:enum", "handle:regex"}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("expected failing columns %v got %v", want, failed)
+	}
+	if len(f.queries) != 0 {
+		t.Errorf("expected no queries got %q", f.all())
+	}
+
+	// the Validate method is called as well
+	if _, err = InsertDb(sqldb, account{Name: "a", Age: 20, Role: "admin"}); !errors.Is(err, errHook) {
+		t.Errorf("expected error of Validate got %v", err)
+	}
+
+	// only the constraints of the updated columns are checked
+	if _, err = UpdateColumnsDb(sqldb, account{ID: 1, Age: 30, Role: "user"}, "age"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err = UpdateDb(sqldb, account{ID: 1, Age: 30, Role: "user"}); !errors.As(err, &verr) || len(verr.Columns) != 1 || verr.Columns[0].Column != "name" {
+		t.Errorf("expected name to be required got %v", err)
+	}
+}
+
+func TestQueryEach(t *testing.T) {
+	f, sqldb := newFakeDb()
+	f.result = func(string, []driver.Value) ([]string, [][]driver.Value) {
+		return []string{"id", "name"}, [][]driver.Value{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"}}
+	}
+
+	var names []string
+	err := QueryEachDb(sqldb, "SELECT * FROM users", func(u ctxUser) error {
+		names = append(names, u.Name)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Errorf("unexpected result %v (%v)", names, err)
+	}
+
+	// an error of the callback stops the iteration
+	names = nil
+	err = QueryEachDb(sqldb, "SELECT * FROM users", func(u ctxUser) error {
+		names = append(names, u.Name)
+		if u.ID == 2 {
+			return errHook
+		}
+		return nil
+	})
+	if !errors.Is(err, errHook) || len(names) != 2 {
+		t.Errorf("expected iteration to stop after 2 rows got %v (%v)", names, err)
+	}
+	if f.closed != 2 {
+		t.Errorf("expected rows to be closed got %d", f.closed)
+	}
+}
+
+func TestKeyset(t *testing.T) {
+	f, sqldb := newFakeDb()
+	f.result = func(_ string, args []driver.Value) ([]string, [][]driver.Value) {
+		return []string{"id", "name"}, [][]driver.Value{{int64(3), "c"}, {int64(4), "d"}, {int64(5), "e"}}
+	}
+	opts := KeysetOptions{Columns: []string{"name", "id"}, Limit: 2, Where: "name <> ?", Args: []any{"x"}}
+
+	page, err := GetKeysetRdb[ctxUser](sqldb, opts, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q, _ := f.last(); q != "SELECT id, name FROM users WHERE (name <> ?) ORDER BY name, id LIMIT 3" {
+		t.Errorf("unexpected query %q", q)
+	}
+	if len(page.Items) != 2 || page.Next == "" || page.Prev != "" {
+		t.Fatalf("unexpected page %+v", page)
+	}
+
+	page, err = GetKeysetRdb[ctxUser](sqldb, opts, page.Next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, args := f.last()
+	if q != "SELECT id, name FROM users WHERE (name <> ?) AND (name > ? OR (name = ? AND id > ?)) ORDER BY name, id LIMIT 3" {
+		t.Errorf("unexpected query %q", q)
+	}
+	if !reflect.DeepEqual(args, []driver.Value{"x", "d", "d", int64(4)}) {
+		t.Errorf("unexpected args %v", args)
+	}
+	if page.Prev == "" {
+		t.Fatal("expected cursor of the previous page")
+	}
+
+	// paging backward reverses the order and the rows
+	page, err = GetKeysetRdb[ctxUser](sqldb, opts, page.Prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, args = f.last()
+	if q != "SELECT id, name FROM users WHERE (name <> ?) AND (name < ? OR (name = ? AND id < ?)) ORDER BY name DESC, id DESC LIMIT 3" {
+		t.Errorf("unexpected query %q", q)
+	}
+	if !reflect.DeepEqual(args, []driver.Value{"x", "c", "c", int64(3)}) {
+		t.Errorf("unexpected args %v", args)
+	}
+	if len(page.Items) != 2 || page.Items[0].ID != 4 || page.Next == "" || page.Prev == "" {
+		t.Errorf("unexpected page %+v", page)
+	}
+
+	if _, err = GetKeysetRdb[ctxUser](sqldb, opts, "invalid"); err == nil {
+		t.Error("expected error for invalid cursor")
+	}
+
+	RegisterDialect(sqldb, sqlpdialect.SQLServer)
+	defer RegisterDialect(sqldb, nil)
+	if _, err = GetKeysetRdb[ctxUser](sqldb, KeysetOptions{Limit: 10}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if q, _ := f.last(); q != "SELECT [id], [name] FROM [users] ORDER BY [id] OFFSET 0 ROWS FETCH NEXT 11 ROWS ONLY" {
+		t.Errorf("unexpected query %q", q)
+	}
+}
+
+func TestGetPage(t *testing.T) {
+	f, sqldb := newFakeDb()
+	f.result = func(query string, _ []driver.Value) ([]string, [][]driver.Value) {
+		if strings.HasPrefix(query, "SELECT COUNT(*)") {
+			return []string{"count"}, [][]driver.Value{{int64(42)}}
+		}
+		return []string{"id", "name"}, [][]driver.Value{{int64(21), "a"}, {int64(22), "b"}}
+	}
+
+	page, err := GetPageRdb[ctxUser](sqldb, "WHERE id > ? ORDER BY name", 3, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 42 || page.Page != 3 || page.Size != 10 || len(page.Items) != 2 {
+		t.Errorf("unexpected page %+v", page)
+	}
+	expected := "SELECT COUNT(*) FROM users WHERE id > ?; SELECT id, name FROM users WHERE id > ? ORDER BY name LIMIT 10 OFFSET 20"
+	if q := f.all(); q != expected {
+		t.Errorf("expected %q got %q", expected, q)
+	}
+
+	if _, err = GetPageRdb[ctxUser](sqldb, "ORDER BY id", 0, 10); err == nil {
+		t.Error("expected error for page 0")
+	}
+	n := len(f.queries)
+	if _, err = GetPageRdb[ctxUser](sqldb, "WHERE id > ?", 1, 10, 1); err == nil {
+		t.Error("expected error for missing order")
+	}
+	if len(f.queries) != n {
+		t.Errorf("expected no queries got %q", f.queries[n:])
+	}
+
+	// GetPageTx runs both queries in a transaction on the global handle
+	SetDatabase(sqldb)
+	defer SetDatabase(nil)
+	f.queries, f.args = nil, nil
+	if _, err = GetPageTx[ctxUser]("ORDER BY id", 1, 10); err != nil {
+		t.Fatal(err)
+	}
+	expected = "BEGIN; SELECT COUNT(*) FROM users; SELECT id, name FROM users ORDER BY id LIMIT 10; COMMIT"
+	if q := f.all(); q != expected {
+		t.Errorf("expected %q got %q", expected, q)
+	}
+}
+
+func TestCountExists(t *testing.T) {
+	f, sqldb := newFakeDb()
+	defer RegisterDialect(sqldb, nil)
+	f.result = func(string, []driver.Value) ([]string, [][]driver.Value) {
+		return []string{"n"}, [][]driver.Value{{int64(1)}}
+	}
+
+	n, err := CountRdb[ctxUser](sqldb, "WHERE name = ? ORDER BY id", "a")
+	if err != nil || n != 1 {
+		t.Errorf("expected 1 got %d (%v)", n, err)
+	}
+	if q, _ := f.last(); q != "SELECT COUNT(*) FROM users WHERE name = ?" {
+		t.Errorf("unexpected query %q", q)
+	}
+
+	// only an ORDER BY outside of parentheses and literals is removed
+	for where, expected := range map[string]string{
+		"WHERE name <> ? ORDER BY lower(name)":                   "SELECT COUNT(*) FROM users WHERE name <> ?",
+		"WHERE name = 'Ä order by x' order  by name":             "SELECT COUNT(*) FROM users WHERE name = 'Ä order by x'",
+		"WHERE id IN (SELECT id FROM users ORDER BY id LIMIT 5)": "SELECT COUNT(*) FROM users WHERE id IN (SELECT id FROM users ORDER BY id LIMIT 5)",
+	} {
+		if _, err = CountRdb[ctxUser](sqldb, where, "a"); err != nil {
+			t.Fatal(err)
+		}
+		if q, _ := f.last(); q != expected {
+			t.Errorf("expected %q got %q", expected, q)
+		}
+	}
+
+	tests := []struct {
+		d     sqlpdialect.Dialect
+		query string
+	}{
+		{sqlpdialect.Postgres, `SELECT EXISTS (SELECT 1 FROM "users" WHERE name = $1)`},
+		{sqlpdialect.SQLServer, "SELECT CASE WHEN EXISTS (SELECT 1 FROM [users] WHERE name = @p1) THEN 1 ELSE 0 END"},
+		{sqlpdialect.Oracle, "SELECT CASE WHEN EXISTS (SELECT 1 FROM users WHERE name = :1) THEN 1 ELSE 0 END FROM DUAL"},
+	}
+	for _, tt := range tests {
+		RegisterDialect(sqldb, tt.d)
+		exists, err := ExistsRdb[ctxUser](sqldb, "WHERE name = ?", "a")
+		if err != nil || !exists {
+			t.Errorf("expected row to exist got %t (%v)", exists, err)
+		}
+		if q, _ := f.last(); q != tt.query {
+			t.Errorf("unexpected query %q", q)
+		}
+	}
+
+	// an "IN"-query without arguments matches no rows
+	if exists, err := ExistsRdb[ctxUser](sqldb, "WHERE id IN (*)"); err != nil || exists {
+		t.Errorf("expected no row got %t (%v)", exists, err)
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	f, sqldb := newFakeDb()
+	defer RegisterDialect(sqldb, nil)
+
+	b := From[ctxUser]().OrderBy("name", "id DESC").Where("id > ?", 18).Limit(10).Offset(20).Where("name LIKE ?", "a%")
+	if _, err := b.All(sqldb); err != nil {
+		t.Fatal(err)
+	}
+	q, args := f.last()
+	if q != "SELECT id, name FROM users WHERE (id > ?) AND (name LIKE ?) ORDER BY name, id DESC LIMIT 10 OFFSET 20" {
+		t.Errorf("unexpected query %q", q)
+	}
+	if !reflect.DeepEqual(args, []driver.Value{int64(18), "a%"}) {
+		t.Errorf("unexpected args %v", args)
+	}
+
+	RegisterDialect(sqldb, sqlpdialect.Postgres)
+	if _, err := From[ctxUser]().Where("id IN (*)", []int{1, 2}).OrderBy("name").All(sqldb); err != nil {
+		t.Fatal(err)
+	}
+	if q, _ = f.last(); q != `SELECT "id", "name" FROM "users" WHERE id IN ($1, $2) ORDER BY "name"` {
+		t.Errorf("unexpected query %q", q)
+	}
+
+	f.result = func(string, []driver.Value) ([]string, [][]driver.Value) {
+		return []string{"n"}, [][]driver.Value{{int64(3)}}
+	}
+	if n, err := From[ctxUser]().Where("name = ?", "a").OrderBy("id").Count(sqldb); err != nil || n != 3 {
+		t.Errorf("expected 3 got %d (%v)", n, err)
+	}
+	if q, _ = f.last(); q != `SELECT COUNT(*) FROM "users" WHERE name = $1` {
+		t.Errorf("unexpected query %q", q)
+	}
+
+	// unknown columns are rejected before a query is run
+	n := len(f.queries)
+	if _, err := From[ctxUser]().Where("nmae = ?", "a").All(sqldb); err == nil {
+		t.Error("expected error for unknown where column")
+	}
+	if _, err := From[ctxUser]().OrderBy("id; DROP TABLE users").All(sqldb); err == nil {
+		t.Error("expected error for invalid order")
+	}
+	if _, err := From[ctxUser]().Offset(10).All(sqldb); err == nil {
+		t.Error("expected error for offset without limit")
+	}
+	if _, err := From[ctxUser]().Limit(10).All(sqldb); err == nil {
+		t.Error("expected error for limit without order")
+	}
+	if len(f.queries) != n {
+		t.Errorf("expected no queries got %q", f.queries[n:])
+	}
+
+	// conditions that do not compare a column are not checked
+	if s := From[ctxUser]().Where("lower(name) = ? OR 1 = 1", "a").String(); s != "SELECT * FROM users WHERE lower(name) = ? OR 1 = 1" {
+		t.Errorf("unexpected query %q", s)
+	}
+}
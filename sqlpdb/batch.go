@@ -0,0 +1,143 @@
+package sqlpdb
+
+import (
+	"context"
+	"fmt"
+	"github.com/ByteSizedMarius/sqlp/sqlpdialect"
+	"github.com/ByteSizedMarius/sqlp/sqlputil"
+	"reflect"
+	"strings"
+)
+
+// InsertManyDb inserts all objects using multi-row "INSERT ... VALUES (...), (...)" statements.
+// The objects are split into chunks to stay below the parameter and row limits of the dialect. The chunks are not
+// inserted atomically; run the function inside a transaction if required.
+//
+// If the dialect retrieves keys using RETURNING, the generated primary keys are written into the elements of objs.
+// Other dialects do not allow retrieving the keys of multi-row inserts, the keys are left unset.
+// As all rows must share the same columns, the omitempty option is not applied. The created and updated columns
+// are set in the elements of objs.
+func InsertManyDb[T Repo](db Executor, objs []T) error {
+	return InsertManyDbContext[T](context.Background(), db, objs)
+}
+
+// InsertManyDbContext is InsertManyDb with a context.
+func InsertManyDbContext[T Repo](ctx context.Context, db Executor, objs []T) error {
+	if isNil(db) {
+		return ErrNotSet
+	}
+	if len(objs) == 0 {
+		return nil
+	}
+
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() != reflect.Struct {
+		return fmt.Errorf("sqlp: dest must be a struct; got %s", typ)
+	}
+	ti := getTypeInfo(typ)
+
+	var fields []*field
+	var colNames []string
+	for _, f := range ti.fields {
+		if f.insertable() {
+			fields = append(fields, f)
+			colNames = append(colNames, f.name)
+		}
+	}
+	if len(fields) == 0 {
+		return fmt.Errorf("sqlp: %s has no columns to insert", typ)
+	}
+
+	d := DialectOf(db)
+	autoCol, autoIdx, generated, err := ti.pk.generated()
+	if err != nil {
+		return err
+	}
+	returning := generated && d.KeyRetrieval() == sqlpdialect.Returning
+
+	if d.MaxInsertRows() < 1 {
+		return fmt.Errorf("sqlp: error inserting multiple rows with %s: %w", d.Name(), sqlpdialect.ErrUnsupported)
+	}
+	perChunk := min(d.MaxParams()/len(fields), d.MaxInsertRows())
+	if perChunk < 1 {
+		return fmt.Errorf("sqlp: %s has more columns than the dialect allows parameters (%d)", typ, d.MaxParams())
+	}
+
+	for i := range objs {
+		if err = beforeInsert(ctx, &objs[i]); err != nil {
+			return err
+		}
+		if err = setTimestamps(reflect.ValueOf(&objs[i]).Elem(), true); err != nil {
+			return err
+		}
+		if err = validate(reflect.ValueOf(&objs[i]).Elem(), colNames); err != nil {
+			return err
+		}
+	}
+
+	tbl := objs[0].TableName()
+	for start := 0; start < len(objs); start += perChunk {
+		chunk := objs[start:min(start+perChunk, len(objs))]
+
+		query, values := insertManyQuery(d, tbl, colNames, fields, chunk)
+		if !returning {
+			if _, err = execDb(ctx, db, query, values...); err != nil {
+				return fmt.Errorf("sqlp: error inserting into %s: %w (query: %s)", tbl, err, query)
+			}
+			continue
+		}
+
+		query += " RETURNING " + d.Quote(autoCol)
+		if err = scanKeys(ctx, db, query, values, chunk, autoIdx); err != nil {
+			return fmt.Errorf("sqlp: error inserting into %s: %w (query: %s)", tbl, err, query)
+		}
+	}
+
+	for i := range objs {
+		if err = afterInsert(ctx, &objs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertManyQuery builds the multi-row insert statement for the objects.
+func insertManyQuery[T any](d sqlpdialect.Dialect, table string, colNames []string, fields []*field, objs []T) (string, []any) {
+	row := "(" + sqlputil.BuildPlaceholders(len(fields)) + ")"
+	values := make([]any, 0, len(fields)*len(objs))
+	for i := range objs {
+		v := reflect.ValueOf(objs[i])
+		for _, f := range fields {
+			values = append(values, v.FieldByIndex(f.index).Interface())
+		}
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", d.Quote(table), quoteJoinDialect(d, colNames, ", "), strings.TrimSuffix(strings.Repeat(row+", ", len(objs)), ", "))
+	return query, values
+}
+
+// scanKeys runs the insert statement and writes the returned keys into the objects, in order.
+func scanKeys[T any](ctx context.Context, db Executor, query string, values []any, objs []T, keyIdx []int) (err error) {
+	rows, err := queryDb(ctx, db, query, values...)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		err = joinOrErr(err, rows.Close())
+	}()
+
+	i := 0
+	for ; rows.Next() && i < len(objs); i++ {
+		if err = rows.Scan(reflect.ValueOf(&objs[i]).Elem().FieldByIndex(keyIdx).Addr().Interface()); err != nil {
+			return
+		}
+	}
+	if err = rowsErr(ctx, rows); err != nil {
+		return
+	}
+	if i != len(objs) {
+		return fmt.Errorf("sqlp: expected %d returned keys; got %d", len(objs), i)
+	}
+	return
+}
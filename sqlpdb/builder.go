@@ -0,0 +1,213 @@
+package sqlpdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Builder composes a SELECT query for the Repo type T. The clauses can be added in any order and are put in the
+// right order when the query is run. Column names are checked against the fields of T; the errors are collected
+// and returned by the method running the query, so no statement is sent for an invalid query.
+//
+//	users, err := NewBuilder[User]().Where("age > ?", 18).OrderBy("name").Limit(10).All(db)
+type Builder[T Repo] struct {
+	conds   []string
+	args    []any
+	orders  []order
+	limit   int
+	offset  int
+	columns fieldInfo
+	err     error
+}
+
+type order struct {
+	col  string
+	desc bool
+}
+
+// condColumn matches the column on the left of a simple condition, e.g. "age" in "age > ?" or "u.name LIKE ?".
+var condColumn = regexp.MustCompile(`(?i)^\s*(?:NOT\s+)?(?:[a-z_]\w*\.)?([a-z_]\w*)\s*(?:=|<>|!=|<=|>=|<|>|LIKE\s|IN\s|IN\(|IS\s|BETWEEN\s)`)
+
+// NewBuilder returns a Builder selecting all rows of T.
+func NewBuilder[T Repo]() *Builder[T] {
+	b := &Builder[T]{}
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() != reflect.Struct {
+		b.err = fmt.Errorf("sqlp: dest must be a struct; got %s", typ)
+		return b
+	}
+	b.columns = getFieldInfo(typ, true, true, false, false)
+	return b
+}
+
+// Where adds a condition, which is combined with the other conditions using AND. If the condition compares a
+// column (e.g. "age > ?"), the column must be mapped by T.
+func (b *Builder[T]) Where(cond string, args ...any) *Builder[T] {
+	if m := condColumn.FindStringSubmatch(cond); m != nil {
+		b.checkColumn(m[1])
+	}
+	b.conds = append(b.conds, cond)
+	b.args = append(b.args, args...)
+	return b
+}
+
+// OrderBy adds columns to sort by. Each column can be followed by ASC or DESC, e.g. "created_at DESC".
+func (b *Builder[T]) OrderBy(cols ...string) *Builder[T] {
+	for _, c := range cols {
+		parts := strings.Fields(c)
+		if len(parts) == 0 || len(parts) > 2 {
+			b.err = errors.Join(b.err, fmt.Errorf("sqlp: invalid order %q", c))
+			continue
+		}
+
+		o := order{col: parts[0]}
+		if len(parts) == 2 {
+			switch strings.ToUpper(parts[1]) {
+			case "ASC":
+			case "DESC":
+				o.desc = true
+			default:
+				b.err = errors.Join(b.err, fmt.Errorf("sqlp: invalid order direction %q", parts[1]))
+				continue
+			}
+		}
+		b.checkColumn(o.col)
+		b.orders = append(b.orders, o)
+	}
+	return b
+}
+
+// Limit limits the number of returned rows. It requires an order, as the rows are returned in an unspecified
+// order otherwise and SQL Server and Oracle only support limits after ORDER BY.
+func (b *Builder[T]) Limit(n int) *Builder[T] {
+	b.limit = n
+	return b
+}
+
+// Offset skips the first n rows. It requires a limit.
+func (b *Builder[T]) Offset(n int) *Builder[T] {
+	b.offset = n
+	return b
+}
+
+// All runs the query and returns all rows.
+func (b *Builder[T]) All(db Executor) ([]T, error) {
+	return b.AllContext(context.Background(), db)
+}
+
+// AllContext is All with a context.
+func (b *Builder[T]) AllContext(ctx context.Context, db Executor) ([]T, error) {
+	query, err := b.build(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return QueryDbContext[T](ctx, db, query, b.args...)
+}
+
+// First runs the query and returns the first row. sql.ErrNoRows is returned if there is none.
+func (b *Builder[T]) First(db Executor) (T, error) {
+	return b.FirstContext(context.Background(), db)
+}
+
+// FirstContext is First with a context.
+func (b *Builder[T]) FirstContext(ctx context.Context, db Executor) (res T, err error) {
+	query, err := b.build(ctx, db)
+	if err != nil {
+		return
+	}
+	return QueryRowDbContext[T](ctx, db, query, b.args...)
+}
+
+// Count returns the number of rows matching the conditions. Order, limit and offset are ignored.
+func (b *Builder[T]) Count(db Executor) (int64, error) {
+	return b.CountContext(context.Background(), db)
+}
+
+// CountContext is Count with a context.
+func (b *Builder[T]) CountContext(ctx context.Context, db Executor) (int64, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	return CountRdbContext[T](ctx, db, b.where(), b.args...)
+}
+
+// Exists reports whether a row matches the conditions. Order, limit and offset are ignored.
+func (b *Builder[T]) Exists(db Executor) (bool, error) {
+	return b.ExistsContext(context.Background(), db)
+}
+
+// ExistsContext is Exists with a context.
+func (b *Builder[T]) ExistsContext(ctx context.Context, db Executor) (bool, error) {
+	if b.err != nil {
+		return false, b.err
+	}
+	return ExistsRdbContext[T](ctx, db, b.where(), b.args...)
+}
+
+// String returns the query without a dialect applied, e.g. for logging.
+func (b *Builder[T]) String() string {
+	query, err := b.build(context.Background(), nil)
+	if err != nil {
+		return err.Error()
+	}
+	return query
+}
+
+func (b *Builder[T]) checkColumn(col string) {
+	if _, ok := b.columns[col]; !ok && b.columns != nil {
+		b.err = errors.Join(b.err, fmt.Errorf("sqlp: unknown column %q for %s", col, reflect.TypeOf((*T)(nil)).Elem()))
+	}
+}
+
+// where returns the WHERE clause of the conditions, or "" if there are none.
+func (b *Builder[T]) where() string {
+	switch len(b.conds) {
+	case 0:
+		return ""
+	case 1:
+		return "WHERE " + b.conds[0]
+	}
+	return "WHERE (" + strings.Join(b.conds, ") AND (") + ")"
+}
+
+// build returns the query in the order SELECT, WHERE, ORDER BY, LIMIT.
+func (b *Builder[T]) build(ctx context.Context, db Executor) (string, error) {
+	if b.err != nil {
+		return "", b.err
+	}
+	if b.offset > 0 && b.limit <= 0 {
+		return "", fmt.Errorf("sqlp: offset requires a limit")
+	}
+	if b.limit > 0 && len(b.orders) == 0 {
+		return "", fmt.Errorf("sqlp: limit requires an order")
+	}
+
+	src, err := selectSource[T](ctx, db)
+	if err != nil {
+		return "", err
+	}
+
+	d := DialectOf(db)
+	query := "SELECT * FROM " + src
+	if w := b.where(); w != "" {
+		query += " " + w
+	}
+	if len(b.orders) > 0 {
+		orders := make([]string, len(b.orders))
+		for i, o := range b.orders {
+			orders[i] = d.Quote(o.col)
+			if o.desc {
+				orders[i] += " DESC"
+			}
+		}
+		query += " ORDER BY " + strings.Join(orders, ", ")
+	}
+	if b.limit > 0 {
+		query += " " + d.Limit(b.limit, b.offset)
+	}
+	return query, nil
+}
@@ -0,0 +1,77 @@
+package sqlpdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// CountRdb returns the number of rows of the table of T matching the where clause. A trailing ORDER BY clause
+// is ignored, so the where clause of GetWhereRdb can be reused.
+//
+//	n, err := CountRdb[User](db, "WHERE age > ?", 18)
+func CountRdb[T Repo](db Executor, where string, args ...any) (int64, error) {
+	return CountRdbContext[T](context.Background(), db, where, args...)
+}
+
+// CountRdbContext is CountRdb with a context.
+func CountRdbContext[T Repo](ctx context.Context, db Executor, where string, args ...any) (int64, error) {
+	src, err := selectSource[T](ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	cond, _ := splitOrderBy(where)
+	query, err := whereBuilder("SELECT COUNT(*) FROM "+src, cond)
+	if err != nil {
+		return 0, err
+	}
+	n, err := QueryBasicRowDbContext[int64](ctx, db, query, args...)
+	// COUNT(*) always returns a row, unless no query was run for an "IN"-query without arguments
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return n, err
+}
+
+// ExistsRdb reports whether the table of T has a row matching the where clause. Unlike counting the rows, the
+// database can stop at the first matching row; the query is built by the dialect, e.g.
+//
+//	SELECT EXISTS (SELECT 1 FROM users WHERE email = ?)
+func ExistsRdb[T Repo](db Executor, where string, args ...any) (bool, error) {
+	return ExistsRdbContext[T](context.Background(), db, where, args...)
+}
+
+// ExistsRdbContext is ExistsRdb with a context.
+func ExistsRdbContext[T Repo](ctx context.Context, db Executor, where string, args ...any) (exists bool, err error) {
+	src, err := selectSource[T](ctx, db)
+	if err != nil {
+		return
+	}
+
+	cond, _ := splitOrderBy(where)
+	query, err := whereBuilder("SELECT 1 FROM "+src, cond)
+	if err != nil {
+		return
+	}
+
+	// an "IN"-query without arguments can not match any row
+	rows, err := doQueryBasicDb(ctx, db, DialectOf(db).Exists(query), args...)
+	if err != nil || rows == nil {
+		return
+	}
+
+	defer func() {
+		err = joinOrErr(err, rows.Close())
+	}()
+
+	if !rows.Next() {
+		err = rowsErr(ctx, rows)
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return
+	}
+	err = rows.Scan(&exists)
+	return
+}
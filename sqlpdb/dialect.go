@@ -0,0 +1,65 @@
+package sqlpdb
+
+import (
+	"context"
+	"database/sql"
+	"github.com/ByteSizedMarius/sqlp/sqlpdialect"
+	"sync"
+)
+
+var (
+	// DefaultDialect is the dialect used for database handles without a registered dialect.
+	DefaultDialect = sqlpdialect.Generic
+
+	// dialects maps database handles to their dialect
+	dialects sync.Map
+)
+
+// Dialecter can be implemented by database handles to provide their dialect.
+// Transactions started by sqlp.WithTx implement it and inherit the dialect of their database.
+type Dialecter interface {
+	Dialect() sqlpdialect.Dialect
+}
+
+// RegisterDialect sets the dialect to use for the given database handle.
+// The dialect controls the placeholder style, identifier quoting and boolean literals of all statements
+// run on the handle. Transactions and connections derived from the handle do not inherit the dialect,
+// unless they are started using sqlp.WithTx.
+func RegisterDialect(db Executor, d sqlpdialect.Dialect) {
+	if d == nil {
+		dialects.Delete(db)
+		return
+	}
+	dialects.Store(db, d)
+}
+
+// DialectOf returns the dialect of the given database handle.
+func DialectOf(db Executor) sqlpdialect.Dialect {
+	if d, ok := db.(Dialecter); ok {
+		return d.Dialect()
+	}
+	if d, ok := dialects.Load(db); ok {
+		return d.(sqlpdialect.Dialect)
+	}
+	return DefaultDialect
+}
+
+// execDb rewrites the placeholders of the query for the dialect of db and executes it.
+func execDb(ctx context.Context, db Executor, query string, args ...any) (sql.Result, error) {
+	return db.ExecContext(ctx, sqlpdialect.Rebind(DialectOf(db), query), args...)
+}
+
+// queryDb rewrites the placeholders of the query for the dialect of db and runs it.
+func queryDb(ctx context.Context, db Executor, query string, args ...any) (*sql.Rows, error) {
+	return db.QueryContext(ctx, sqlpdialect.Rebind(DialectOf(db), query), args...)
+}
+
+// queryRowDb rewrites the placeholders of the query for the dialect of db and runs it, returning a single row.
+func queryRowDb(ctx context.Context, db Executor, query string, args ...any) *sql.Row {
+	return db.QueryRowContext(ctx, sqlpdialect.Rebind(DialectOf(db), query), args...)
+}
+
+// quote quotes the identifier using the dialect of db.
+func quote(db Executor, ident string) string {
+	return DialectOf(db).Quote(ident)
+}
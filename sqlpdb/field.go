@@ -0,0 +1,277 @@
+package sqlpdb
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Options of the sql tag. They are given after the column name, separated by commas:
+//
+//	type User struct {
+//		ID        int       `sql:"id,pk,auto"`
+//		Email     string    `sql:"email"`
+//		CreatedAt time.Time `sql:"created_at,created"`
+//		Score     int       `sql:",readonly"` // column name is taken from the field name
+//		Nickname  string    `sql:"nickname,omitempty"`
+//		UpdatedAt time.Time `sql:"updated_at,updated"`
+//		Version   int       `sql:"version,version"`
+//		DeletedAt *time.Time `sql:"deleted_at,softdelete"`
+//	}
+//
+// Unknown options are reported as errors when objects are inserted or updated.
+const (
+	// OptPk marks the primary key. Composite primary keys consist of multiple fields with this option.
+	OptPk = "pk"
+
+	// OptAuto marks columns generated by the database. They are omitted from inserts and updates.
+	// Together with OptPk, the generated key is written back after inserts.
+	OptAuto = "auto"
+
+	// OptReadonly marks columns which are read, but never written.
+	OptReadonly = "readonly"
+
+	// OptInsertOnly marks columns which are written on insert, but not on update.
+	OptInsertOnly = "insertonly"
+
+	// OptOmitEmpty omits the column from inserts if the field has its zero value, so the database default is used.
+	OptOmitEmpty = "omitempty"
+
+	// OptVersion marks an integer column used for optimistic locking. Updates only match the row if its version
+	// is still the one of the object and increment it; otherwise ErrStaleObject is returned.
+	OptVersion = "version"
+
+	// OptSoftDelete marks a nullable timestamp column (*time.Time or sql.NullTime) which is set instead of deleting
+	// the row and never inserted. Rows where it is not NULL are excluded by the Get functions, see WithDeleted,
+	// OnlyDeleted and HardDelete.
+	OptSoftDelete = "softdelete"
+
+	// OptCreated marks a timestamp column which is set to the current time (see Now) on insert and never updated.
+	OptCreated = "created"
+
+	// OptUpdated marks a timestamp column which is set to the current time on insert and on every update.
+	OptUpdated = "updated"
+)
+
+type (
+	// field contains the metadata of a mapped struct field, parsed from its tags.
+	field struct {
+		name  string
+		index []int
+		typ   reflect.Type
+
+		pk         bool
+		auto       bool
+		readonly   bool
+		insertOnly bool
+		omitEmpty  bool
+		version    bool
+		softDelete bool
+		created    bool
+		updated    bool
+
+		constraints []constraint
+
+		// err is set if the sql tag has an unknown option, it is reported by every validation
+		err error
+	}
+
+	// typeInfo contains the metadata of all mapped fields of a struct type.
+	typeInfo struct {
+		// fields in the order of the struct, embedded structs are flattened
+		fields []*field
+
+		// byName maps the column names to the fields
+		byName map[string]*field
+
+		pk pkInfo
+	}
+)
+
+// getTypeInfo returns the cached typeInfo of the given struct type, parsing it on first use.
+func getTypeInfo(typ reflect.Type) *typeInfo {
+	fieldInfoCacheLock.RLock()
+	ti, ok := typeInfoCache[typ]
+	fieldInfoCacheLock.RUnlock()
+	if ok {
+		return ti
+	}
+
+	ti = &typeInfo{byName: make(map[string]*field)}
+	for _, f := range parseFields(typ, nil, field{}) {
+		ti.fields = append(ti.fields, f)
+		ti.byName[f.name] = f
+
+		if f.pk {
+			ti.pk.cols = append(ti.pk.cols, f.name)
+			ti.pk.idxs = append(ti.pk.idxs, f.index)
+			ti.pk.auto = append(ti.pk.auto, f.auto)
+		}
+	}
+
+	fieldInfoCacheLock.Lock()
+	typeInfoCache[typ] = ti
+	fieldInfoCacheLock.Unlock()
+
+	return ti
+}
+
+// parseFields parses the fields of the given struct type. Fields that are unexported or tagged with "-" are not
+// included. The options of embedded structs are inherited by their fields.
+func parseFields(typ reflect.Type, index []int, parent field) []*field {
+	var fields []*field
+
+	n := typ.NumField()
+	for i := 0; i < n; i++ {
+		sf := typ.Field(i)
+
+		// Skip unexported fields or fields marked with "-"
+		if sf.PkgPath != "" || sf.Tag.Get(TagName) == "-" {
+			continue
+		}
+
+		f := parseField(sf)
+		f.index = append(append([]int{}, index...), i)
+		f.readonly = f.readonly || parent.readonly
+		f.insertOnly = f.insertOnly || parent.insertOnly
+
+		// Handle embedded structs
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			scannerType := reflect.TypeOf((*Scanner)(nil)).Elem()
+			if !reflect.PointerTo(sf.Type).Implements(scannerType) {
+				fields = append(fields, parseFields(sf.Type, f.index, *f)...)
+				continue
+			}
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+// parseField parses the sql and sql-validate tags of the struct field and the legacy tags (sql-auto, sql-pk,
+// sql-ign, sql-ign-edit).
+func parseField(sf reflect.StructField) *field {
+	name, opts, _ := strings.Cut(sf.Tag.Get(TagName), ",")
+
+	// Use field name for untagged fields
+	if name == "" {
+		name = sf.Name
+	}
+	f := &field{name: NameMapper(name), typ: sf.Type}
+
+	for _, opt := range strings.Split(opts, ",") {
+		switch strings.TrimSpace(opt) {
+		case OptPk:
+			f.pk = true
+		case OptAuto:
+			f.auto = true
+		case OptReadonly:
+			f.readonly = true
+		case OptInsertOnly:
+			f.insertOnly = true
+		case OptOmitEmpty:
+			f.omitEmpty = true
+		case OptVersion:
+			f.version = true
+		case OptSoftDelete:
+			f.softDelete = true
+		case OptCreated:
+			f.created = true
+		case OptUpdated:
+			f.updated = true
+		case "":
+		default:
+			f.err = fmt.Errorf("sqlp: unknown option %q in sql tag of field %s", strings.TrimSpace(opt), sf.Name)
+		}
+	}
+
+	if _, ok := sf.Tag.Lookup(AutoGenTagName); ok {
+		f.pk, f.auto = true, true
+	}
+	if _, ok := sf.Tag.Lookup(PkTagName); ok {
+		f.pk = true
+	}
+	if _, ok := sf.Tag.Lookup(IgnoreTagName); ok {
+		f.readonly = true
+	}
+	if _, ok := sf.Tag.Lookup(IgnoreEditTagName); ok {
+		f.insertOnly = true
+	}
+	f.constraints = parseConstraints(sf.Tag.Get(ValidateTagName))
+
+	return f
+}
+
+// insertable reports whether the field is written by inserts. Soft-delete columns are only set by deletes.
+func (f *field) insertable() bool {
+	return !f.auto && !f.readonly && !f.softDelete
+}
+
+// updatable reports whether the field is written by updates. Primary keys are never updated,
+// version columns are incremented by the update itself, soft-delete columns are only set by deletes and
+// created columns only by inserts.
+func (f *field) updatable() bool {
+	return !f.pk && !f.auto && !f.readonly && !f.insertOnly && !f.version && !f.softDelete && !f.created
+}
+
+// versionField returns the version column of the type, or nil if it has none.
+func (ti *typeInfo) versionField() (*field, error) {
+	var ver *field
+	for _, f := range ti.fields {
+		if !f.version {
+			continue
+		}
+		if ver != nil {
+			return nil, fmt.Errorf("sqlp: expected at most one version column; got %q and %q", ver.name, f.name)
+		}
+		if keyKind(f.typ.Kind()) != "int" {
+			return nil, fmt.Errorf("sqlp: version column %q must be an integer; got %s", f.name, f.typ)
+		}
+		ver = f
+	}
+	return ver, nil
+}
+
+// setTimestamps sets the updated columns of the struct v, and on insert also the created columns, to the current time.
+func setTimestamps(v reflect.Value, insert bool) error {
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var now time.Time
+	for _, f := range getTypeInfo(v.Type()).fields {
+		if !f.updated && !(insert && f.created) {
+			continue
+		}
+		if now.IsZero() {
+			now = Now()
+		}
+
+		fv := v.FieldByIndex(f.index)
+		switch fv.Interface().(type) {
+		case time.Time:
+			fv.Set(reflect.ValueOf(now))
+		case *time.Time:
+			t := now
+			fv.Set(reflect.ValueOf(&t))
+		case sql.NullTime:
+			fv.Set(reflect.ValueOf(sql.NullTime{Time: now, Valid: true}))
+		default:
+			return fmt.Errorf("sqlp: timestamp column %q must be a time.Time, *time.Time or sql.NullTime; got %s", f.name, f.typ)
+		}
+	}
+	return nil
+}
+
+// incVersion increments the integer version field v.
+func incVersion(v reflect.Value) {
+	if v.CanInt() {
+		v.SetInt(v.Int() + 1)
+	} else {
+		v.SetUint(v.Uint() + 1)
+	}
+}
@@ -0,0 +1,106 @@
+package sqlpdb
+
+import (
+	"context"
+	"reflect"
+)
+
+// Hooks are optional interfaces of Repo types, which are called by the functions of this package.
+// They are looked up on the pointer to the object, so they can modify it:
+//
+//	func (u *User) BeforeInsert(ctx context.Context) error {
+//		u.Email = strings.ToLower(u.Email)
+//		return nil
+//	}
+//
+// An error returned by a Before hook aborts the operation before a statement is run. An error returned by an
+// After hook is returned after the statement has been run.
+type (
+	// BeforeInserter is called before the object is inserted, including by InsertManyDb and UpsertDb.
+	BeforeInserter interface {
+		BeforeInsert(ctx context.Context) error
+	}
+
+	// AfterInserter is called after the object was inserted and its generated key was written into it.
+	AfterInserter interface {
+		AfterInsert(ctx context.Context) error
+	}
+
+	// BeforeUpdater is called before the object is updated.
+	BeforeUpdater interface {
+		BeforeUpdate(ctx context.Context) error
+	}
+
+	// AfterUpdater is called after the object was updated.
+	AfterUpdater interface {
+		AfterUpdate(ctx context.Context) error
+	}
+
+	// BeforeDeleter is called before the object is deleted. If the row is deleted by its primary key, it is called
+	// on an object which only has the primary key fields set.
+	BeforeDeleter interface {
+		BeforeDelete(ctx context.Context) error
+	}
+
+	// AfterScanner is called after a row was scanned into the object.
+	AfterScanner interface {
+		AfterScan(ctx context.Context) error
+	}
+)
+
+func beforeInsert(ctx context.Context, obj any) error {
+	if h, ok := obj.(BeforeInserter); ok {
+		return h.BeforeInsert(ctx)
+	}
+	return nil
+}
+
+func afterInsert(ctx context.Context, obj any) error {
+	if h, ok := obj.(AfterInserter); ok {
+		return h.AfterInsert(ctx)
+	}
+	return nil
+}
+
+func beforeUpdate(ctx context.Context, obj any) error {
+	if h, ok := obj.(BeforeUpdater); ok {
+		return h.BeforeUpdate(ctx)
+	}
+	return nil
+}
+
+func afterUpdate(ctx context.Context, obj any) error {
+	if h, ok := obj.(AfterUpdater); ok {
+		return h.AfterUpdate(ctx)
+	}
+	return nil
+}
+
+func afterScan(ctx context.Context, obj any) error {
+	if h, ok := obj.(AfterScanner); ok {
+		return h.AfterScan(ctx)
+	}
+	return nil
+}
+
+// beforeDelete calls the BeforeDelete hook of T. If obj is nil, the hook is called on an object with the given
+// primary key values.
+func beforeDelete[T any](ctx context.Context, obj *T, pkIdxs [][]int, pks []any) error {
+	if _, ok := any(obj).(BeforeDeleter); !ok {
+		return nil
+	}
+
+	if obj == nil {
+		obj = new(T)
+		v := reflect.ValueOf(obj).Elem()
+		for i, idx := range pkIdxs {
+			f, pk := v.FieldByIndex(idx), reflect.ValueOf(pks[i])
+			if f.Kind() == reflect.Pointer && !pk.Type().AssignableTo(f.Type()) {
+				f.Set(reflect.New(f.Type().Elem()))
+				f = f.Elem()
+			}
+			f.Set(pk.Convert(f.Type()))
+		}
+	}
+	return any(obj).(BeforeDeleter).BeforeDelete(ctx)
+}
@@ -0,0 +1,45 @@
+package sqlpdb
+
+import (
+	"context"
+)
+
+// QueryEachDb is QueryDb, but instead of collecting the results in a slice, the rows are scanned one at a time and
+// passed to fn. This keeps the memory usage constant for large result sets. If fn returns an error, the
+// iteration stops, the rows are closed and the error is returned.
+//
+//	err := QueryEachDb(db, "SELECT * FROM users", func(u User) error {
+//		return enc.Encode(u)
+//	})
+func QueryEachDb[T any](db Executor, query string, fn func(T) error, args ...any) error {
+	return QueryEachDbContext[T](context.Background(), db, query, fn, args...)
+}
+
+// QueryEachDbContext is QueryEachDb with a context.
+func QueryEachDbContext[T any](ctx context.Context, db Executor, query string, fn func(T) error, args ...any) (err error) {
+	rows, err := doQueryDb[T](ctx, db, query, args...)
+	if err != nil || rows == nil {
+		return
+	}
+
+	defer func() {
+		err = joinOrErr(err, rows.Close())
+	}()
+
+	return eachRow[T](ctx, rows, fn)
+}
+
+// GetEachRdb is GetRdb, but passes the rows to fn one at a time. See QueryEachDb.
+func GetEachRdb[T Repo](db Executor, fn func(T) error) error {
+	return GetEachRdbContext[T](context.Background(), db, fn)
+}
+
+// GetEachRdbContext is GetEachRdb with a context.
+func GetEachRdbContext[T Repo](ctx context.Context, db Executor, fn func(T) error) error {
+	src, err := selectSource[T](ctx, db)
+	if err != nil {
+		return err
+	}
+
+	return QueryEachDbContext[T](ctx, db, "SELECT * FROM "+src, fn)
+}
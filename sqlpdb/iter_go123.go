@@ -0,0 +1,61 @@
+//go:build go1.23
+
+package sqlpdb
+
+import (
+	"context"
+	"errors"
+	"iter"
+)
+
+// errStopIteration ends the callback iteration when the consumer of an iterator stops early.
+var errStopIteration = errors.New("sqlp: iteration stopped")
+
+// QueryIterDb is QueryEachDb as an iterator. An error ends the iteration and is yielded with the zero value
+// of T. The rows are closed when the iteration ends, including when the loop is left early.
+//
+//	for u, err := range QueryIterDb[User](db, "SELECT * FROM users") {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func QueryIterDb[T any](db Executor, query string, args ...any) iter.Seq2[T, error] {
+	return QueryIterDbContext[T](context.Background(), db, query, args...)
+}
+
+// QueryIterDbContext is QueryIterDb with a context.
+func QueryIterDbContext[T any](ctx context.Context, db Executor, query string, args ...any) iter.Seq2[T, error] {
+	return seq(func(fn func(T) error) error {
+		return QueryEachDbContext[T](ctx, db, query, fn, args...)
+	})
+}
+
+// GetIterRdb is GetRdb as an iterator. See QueryIterDb.
+func GetIterRdb[T Repo](db Executor) iter.Seq2[T, error] {
+	return GetIterRdbContext[T](context.Background(), db)
+}
+
+// GetIterRdbContext is GetIterRdb with a context.
+func GetIterRdbContext[T Repo](ctx context.Context, db Executor) iter.Seq2[T, error] {
+	return seq(func(fn func(T) error) error {
+		return GetEachRdbContext[T](ctx, db, fn)
+	})
+}
+
+// seq turns a callback iteration into an iterator. When the consumer stops early, errStopIteration is returned
+// from the callback, which ends the iteration and closes the rows.
+func seq[T any](each func(fn func(T) error) error) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		err := each(func(t T) error {
+			if !yield(t, nil) {
+				return errStopIteration
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopIteration) {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package sqlpdb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// InsertKeyDb inserts the object and returns the generated primary key as K.
+// K must match the type of the primary key field, otherwise an error is returned before the insert is run.
+// Integer keys can be returned as any integer type, e.g. an int64 key as int.
+func InsertKeyDb[T Repo, K comparable](db Executor, obj T) (K, error) {
+	return InsertKeyDbContext[T, K](context.Background(), db, obj)
+}
+
+// InsertKeyDbContext is InsertKeyDb with a context.
+func InsertKeyDbContext[T Repo, K comparable](ctx context.Context, db Executor, obj T) (k K, err error) {
+	pkTyp, err := pkType[T]()
+	if err != nil {
+		return
+	}
+	if err = checkKeyType[T](pkTyp, reflect.TypeOf((*K)(nil)).Elem()); err != nil {
+		return
+	}
+
+	key, err := insertRow(ctx, db, &obj, obj.TableName(), false)
+	if err != nil {
+		return
+	}
+
+	v := reflect.ValueOf(key)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	return v.Convert(reflect.TypeOf((*K)(nil)).Elem()).Interface().(K), nil
+}
+
+// GetKeyDb retrieves the row with the given primary key. K must match the type of the primary key field.
+func GetKeyDb[T Repo, K comparable](db Executor, pk K) (T, error) {
+	return GetKeyDbContext[T, K](context.Background(), db, pk)
+}
+
+// GetKeyDbContext is GetKeyDb with a context.
+func GetKeyDbContext[T Repo, K comparable](ctx context.Context, db Executor, pk K) (T, error) {
+	return GetPkDbContext[T](ctx, db, pk)
+}
+
+// DeleteKeyDb deletes the row with the given primary key. K must match the type of the primary key field.
+func DeleteKeyDb[T Repo, K comparable](db Executor, pk K) (int64, error) {
+	return DeleteKeyDbContext[T, K](context.Background(), db, pk)
+}
+
+// DeleteKeyDbContext is DeleteKeyDb with a context.
+func DeleteKeyDbContext[T Repo, K comparable](ctx context.Context, db Executor, pk K) (int64, error) {
+	return DeletePkDbContext[T](ctx, db, pk)
+}
+
+// pkType returns the type of the primary key field of T.
+func pkType[T any]() (reflect.Type, error) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	_, pkIdx, err := getPkFieldInfo(typ)
+	if err != nil {
+		return nil, err
+	}
+	return typ.FieldByIndex(pkIdx).Type, nil
+}
+
+// checkKeys returns an error if the given values can not be used as the (composite) primary key of T.
+func checkKeys[T any](pks []any) error {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	_, pkIdxs, err := getPkFieldsInfo(typ)
+	if err != nil {
+		return err
+	}
+	if len(pks) != len(pkIdxs) {
+		return fmt.Errorf("sqlp: primary key of %s has %d columns; got %d values", typ, len(pkIdxs), len(pks))
+	}
+
+	for i, pk := range pks {
+		pkTyp := typ.FieldByIndex(pkIdxs[i]).Type
+		if pk == nil {
+			return fmt.Errorf("sqlp: primary key of %s is of type %s; got nil", typ, pkTyp)
+		}
+		if err = checkKeyType[T](pkTyp, reflect.TypeOf(pk)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkKeyType returns an error if values of type got can not be used for the primary key field of type want.
+// Besides identical types, all integer types, all float types and all string types are compatible with each other.
+func checkKeyType[T any](want, got reflect.Type) error {
+	if got == want || got.AssignableTo(want) {
+		return nil
+	}
+
+	w := want
+	if w.Kind() == reflect.Pointer {
+		w = w.Elem()
+	}
+	if keyKind(w.Kind()) != "" && keyKind(w.Kind()) == keyKind(got.Kind()) {
+		return nil
+	}
+
+	return fmt.Errorf("sqlp: primary key of %s is of type %s; got %s", reflect.TypeOf((*T)(nil)).Elem(), want, got)
+}
+
+// keyKind groups the kinds of compatible primary key types.
+func keyKind(k reflect.Kind) string {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.String:
+		return "string"
+	}
+	return ""
+}
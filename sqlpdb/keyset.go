@@ -0,0 +1,228 @@
+package sqlpdb
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/ByteSizedMarius/sqlp/sqlpdialect"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+type (
+	// KeysetOptions configures GetKeysetRdb.
+	KeysetOptions struct {
+		// Columns are the columns the rows are sorted by, in ascending order. Together, their values must be unique,
+		// e.g. by ending with the primary key. Defaults to the primary key columns.
+		Columns []string
+
+		// Limit is the maximum number of rows of a page.
+		Limit int
+
+		// Where is an optional condition (without "WHERE") the rows must fulfil. Args are its arguments.
+		Where string
+		Args  []any
+	}
+
+	// KeysetPage is a page of rows returned by GetKeysetRdb.
+	KeysetPage[T any] struct {
+		Items []T
+
+		// Next and Prev are the cursors of the following and the preceding page.
+		// They are empty if there is no such page.
+		Next string
+		Prev string
+	}
+
+	// keysetCursor is the decoded form of the cursors. The values are stored as JSON to keep their types when
+	// they are decoded into the types of the fields.
+	keysetCursor struct {
+		Prev   bool              `json:"p,omitempty"`
+		Values []json.RawMessage `json:"v"`
+	}
+)
+
+// GetKeysetRdb returns the page of rows following (or, for cursors taken from KeysetPage.Prev, preceding) the
+// cursor. An empty cursor returns the first page. Unlike LIMIT/OFFSET, the rows before the page are not read,
+// so the query is fast for every page if there is an index on the sort columns:
+//
+//	SELECT * FROM users WHERE (name > ? OR (name = ? AND id > ?)) ORDER BY name, id LIMIT 21
+//
+// Cursors are only valid for the same options.
+func GetKeysetRdb[T Repo](db Executor, opts KeysetOptions, cursor string) (KeysetPage[T], error) {
+	return GetKeysetRdbContext[T](context.Background(), db, opts, cursor)
+}
+
+// GetKeysetRdbContext is GetKeysetRdb with a context.
+func GetKeysetRdbContext[T Repo](ctx context.Context, db Executor, opts KeysetOptions, cursor string) (page KeysetPage[T], err error) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() != reflect.Struct {
+		return page, fmt.Errorf("sqlp: dest must be a struct; got %s", typ)
+	}
+	if opts.Limit < 1 {
+		return page, fmt.Errorf("sqlp: keyset limit must be positive; got %d", opts.Limit)
+	}
+
+	ti := getTypeInfo(typ)
+	cols := opts.Columns
+	if len(cols) == 0 {
+		cols = ti.pk.cols
+	}
+	if len(cols) == 0 {
+		return page, fmt.Errorf("sqlp: expected sort columns or a primary key for %s", typ)
+	}
+	fields := make([]*field, len(cols))
+	for i, c := range cols {
+		f, ok := ti.byName[c]
+		if !ok {
+			return page, fmt.Errorf("sqlp: unknown sort column %q for %s", c, typ)
+		}
+		fields[i] = f
+	}
+
+	src, err := selectSource[T](ctx, db)
+	if err != nil {
+		return
+	}
+
+	d := DialectOf(db)
+	var conds []string
+	args := slices.Clone(opts.Args)
+	if opts.Where != "" {
+		conds = append(conds, "("+opts.Where+")")
+	}
+
+	var cur keysetCursor
+	if cursor != "" {
+		var values []any
+		cur, values, err = decodeCursor(cursor, fields)
+		if err != nil {
+			return
+		}
+
+		op := ">"
+		if cur.Prev {
+			op = "<"
+		}
+		cond, condArgs := rowCompare(d, cols, op, values)
+		conds = append(conds, cond)
+		args = append(args, condArgs...)
+	}
+
+	order := quoteJoinDialect(d, cols, ", ")
+	if cur.Prev {
+		order = quoteJoinDialect(d, cols, " DESC, ") + " DESC"
+	}
+
+	query := "SELECT * FROM " + src
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	// one more row than requested tells whether there is another page
+	query += " ORDER BY " + order + " " + d.Limit(opts.Limit+1, 0)
+
+	items, err := QueryDbContext[T](ctx, db, query, args...)
+	if err != nil {
+		return
+	}
+
+	more := len(items) > opts.Limit
+	if more {
+		items = items[:opts.Limit]
+	}
+	if cur.Prev {
+		slices.Reverse(items)
+	}
+	page.Items = items
+	if len(items) == 0 {
+		return
+	}
+
+	// paging forward, there is a preceding page if a cursor was given; paging backward, there is a following one
+	hasNext, hasPrev := more, cursor != ""
+	if cur.Prev {
+		hasNext, hasPrev = true, more
+	}
+
+	if hasNext {
+		if page.Next, err = encodeCursor(reflect.ValueOf(items[len(items)-1]), fields, false); err != nil {
+			return
+		}
+	}
+	if hasPrev {
+		page.Prev, err = encodeCursor(reflect.ValueOf(items[0]), fields, true)
+	}
+	return
+}
+
+// rowCompare returns the comparison of the columns with the values in sort order and its arguments, e.g.
+// "(a > ? OR (a = ? AND b > ?))". Unlike the row value comparison "(a, b) > (?, ?)", it is supported by every
+// database.
+func rowCompare(d sqlpdialect.Dialect, cols []string, op string, values []any) (string, []any) {
+	if len(cols) == 1 {
+		return d.Quote(cols[0]) + " " + op + " ?", values
+	}
+
+	var ors []string
+	var args []any
+	for i := range cols {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, d.Quote(cols[j])+" = ?")
+		}
+		ands = append(ands, d.Quote(cols[i])+" "+op+" ?")
+		args = append(args, values[:i+1]...)
+
+		if len(ands) == 1 {
+			ors = append(ors, ands[0])
+		} else {
+			ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+		}
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+// encodeCursor returns the cursor pointing at the sort columns of the row v.
+func encodeCursor(v reflect.Value, fields []*field, prev bool) (string, error) {
+	cur := keysetCursor{Prev: prev, Values: make([]json.RawMessage, len(fields))}
+	for i, f := range fields {
+		b, err := json.Marshal(v.FieldByIndex(f.index).Interface())
+		if err != nil {
+			return "", fmt.Errorf("sqlp: error encoding cursor column %q: %w", f.name, err)
+		}
+		cur.Values[i] = b
+	}
+
+	b, err := json.Marshal(cur)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor decodes the cursor and returns the values of the sort columns as the types of their fields.
+func decodeCursor(cursor string, fields []*field) (keysetCursor, []any, error) {
+	var cur keysetCursor
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(b, &cur)
+	}
+	if err == nil && len(cur.Values) != len(fields) {
+		err = fmt.Errorf("expected %d values; got %d", len(fields), len(cur.Values))
+	}
+	if err != nil {
+		return cur, nil, fmt.Errorf("sqlp: invalid cursor: %w", err)
+	}
+
+	values := make([]any, len(fields))
+	for i, f := range fields {
+		ptr := reflect.New(f.typ)
+		if err = json.Unmarshal(cur.Values[i], ptr.Interface()); err != nil {
+			return cur, nil, fmt.Errorf("sqlp: invalid cursor value for column %q: %w", f.name, err)
+		}
+		values[i] = ptr.Elem().Interface()
+	}
+	return cur, values, nil
+}
@@ -0,0 +1,105 @@
+package sqlpdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Page is a page of rows returned by GetPageRdb.
+type Page[T any] struct {
+	Items []T
+
+	// Total is the number of rows matching the where clause on all pages.
+	Total int64
+
+	// Page is the 1-based number of the page, Size the maximum number of rows per page.
+	Page int
+	Size int
+}
+
+// GetPageRdb returns the rows of the given 1-based page, together with the total number of rows matching the where
+// clause. It runs a COUNT(*) query and a LIMIT/OFFSET query with the same where clause, which must end with an
+// ORDER BY clause, as the rows of the pages are in an unspecified order otherwise (and SQL Server and Oracle only
+// support limits after ORDER BY):
+//
+//	page, err := GetPageRdb[User](db, "WHERE age > ? ORDER BY name", 2, 20, 18)
+//
+// Pass a transaction as db to get a total count consistent with the rows.
+func GetPageRdb[T Repo](db Executor, where string, page, size int, args ...any) (Page[T], error) {
+	return GetPageRdbContext[T](context.Background(), db, where, page, size, args...)
+}
+
+// GetPageRdbContext is GetPageRdb with a context.
+func GetPageRdbContext[T Repo](ctx context.Context, db Executor, where string, page, size int, args ...any) (res Page[T], err error) {
+	if page < 1 || size < 1 {
+		return res, fmt.Errorf("sqlp: page and size must be positive; got %d and %d", page, size)
+	}
+	if _, orderBy := splitOrderBy(where); orderBy == "" {
+		return res, fmt.Errorf("sqlp: page requires an ORDER BY clause")
+	}
+	res.Page, res.Size = page, size
+
+	res.Total, err = CountRdbContext[T](ctx, db, where, args...)
+	if err != nil || res.Total == 0 {
+		return
+	}
+
+	src, err := selectSource[T](ctx, db)
+	if err != nil {
+		return
+	}
+	query, err := whereBuilder("SELECT * FROM "+src, where)
+	if err != nil {
+		return
+	}
+	query += " " + DialectOf(db).Limit(size, (page-1)*size)
+
+	res.Items, err = QueryDbContext[T](ctx, db, query, args...)
+	return
+}
+
+// splitOrderBy splits a trailing ORDER BY clause off the where clause. Only an ORDER BY outside of parentheses
+// and quotes is split off, as others belong to subqueries or literals.
+func splitOrderBy(where string) (cond string, orderBy string) {
+	i := -1
+	depth := 0
+	var inQuote byte
+	for j := 0; j < len(where); j++ {
+		switch c := where[j]; {
+		case inQuote != 0:
+			if c == inQuote {
+				inQuote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			inQuote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && isOrderBy(where, j):
+			i = j
+		}
+	}
+	if i < 0 {
+		return where, ""
+	}
+	return strings.TrimSpace(where[:i]), where[i:]
+}
+
+// isOrderBy reports whether the keywords ORDER BY start at index i of s.
+func isOrderBy(s string, i int) bool {
+	if (i > 0 && isIdentByte(s[i-1])) || len(s) < i+5 || !strings.EqualFold(s[i:i+5], "ORDER") {
+		return false
+	}
+	rest := s[i+5:]
+	by := strings.TrimLeft(rest, " \t\r\n")
+	if len(by) == len(rest) || len(by) < 2 || !strings.EqualFold(by[:2], "BY") {
+		return false
+	}
+	return len(by) == 2 || !isIdentByte(by[2])
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
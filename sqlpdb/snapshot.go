@@ -0,0 +1,105 @@
+package sqlpdb
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"reflect"
+)
+
+// Snapshot holds the values of the updatable columns of an object at the time it was taken.
+// SaveDb compares an object to its snapshot and only updates the columns that changed.
+//
+//	user, err := GetPkDb[User](db, 1)
+//	snap := TakeSnapshot(user)
+//	user.Name = "new"
+//	changed, err := SaveDb(db, snap, user) // UPDATE users SET name=? WHERE id=?
+type Snapshot[T Repo] struct {
+	values map[string]any
+}
+
+// TakeSnapshot takes a snapshot of the object.
+func TakeSnapshot[T Repo](obj T) *Snapshot[T] {
+	s := &Snapshot[T]{}
+	s.take(obj)
+	return s
+}
+
+func (s *Snapshot[T]) take(obj T) {
+	v := reflect.ValueOf(obj)
+	ti := getTypeInfo(v.Type())
+
+	s.values = make(map[string]any, len(ti.fields))
+	for _, f := range ti.fields {
+		if f.updatable() && !f.updated {
+			s.values[f.name] = snapshotValue(v.FieldByIndex(f.index))
+		}
+	}
+}
+
+// Changed returns the columns whose values differ between the object and the snapshot, in field order.
+// Updated columns are not compared, as they are written by every update.
+func (s *Snapshot[T]) Changed(obj T) []string {
+	v := reflect.ValueOf(obj)
+	ti := getTypeInfo(v.Type())
+
+	var changed []string
+	for _, f := range ti.fields {
+		if !f.updatable() || f.updated {
+			continue
+		}
+		if !snapshotEqual(s.values[f.name], snapshotValue(v.FieldByIndex(f.index))) {
+			changed = append(changed, f.name)
+		}
+	}
+	return changed
+}
+
+// SaveDb updates the columns of obj that changed since the snapshot was taken. If nothing changed, no statement
+// is run and false is returned. After a successful update, the snapshot is updated to the values of obj.
+// If the row does not exist, ErrNotFound is returned. As obj is passed by value, the incremented version of
+// types with a version column is not written back; use UpdatePtrDb for objects that are updated repeatedly.
+func SaveDb[T Repo](db Executor, snap *Snapshot[T], obj T) (bool, error) {
+	return SaveDbContext[T](context.Background(), db, snap, obj)
+}
+
+// SaveDbContext is SaveDb with a context.
+func SaveDbContext[T Repo](ctx context.Context, db Executor, snap *Snapshot[T], obj T) (bool, error) {
+	changed := snap.Changed(obj)
+	if len(changed) == 0 {
+		return false, nil
+	}
+
+	n, err := updateHelper(ctx, db, &obj, obj.TableName(), changed)
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, ErrNotFound
+	}
+
+	snap.take(obj)
+	return true, nil
+}
+
+// snapshotValue returns the value as it would be sent to the database, so that values which were modified in
+// place (e.g. byte slices or values behind pointers) are detected as changes. Values that can not be converted
+// are kept as they are.
+func snapshotValue(v reflect.Value) any {
+	val, err := driver.DefaultParameterConverter.ConvertValue(v.Interface())
+	if err != nil {
+		return v.Interface()
+	}
+	if b, ok := val.([]byte); ok {
+		return bytes.Clone(b)
+	}
+	return val
+}
+
+func snapshotEqual(a, b any) bool {
+	if ab, ok := a.([]byte); ok {
+		bb, ok := b.([]byte)
+		return ok && bytes.Equal(ab, bb) && (ab == nil) == (bb == nil)
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,110 @@
+package sqlpdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type (
+	// deletedScope selects which rows of types with a soft-delete column are read.
+	deletedScope int
+
+	deletedScopeKey struct{}
+	hardDeleteKey   struct{}
+)
+
+const (
+	excludeDeleted deletedScope = iota
+	includeDeleted
+	onlyDeleted
+)
+
+// WithDeleted returns a context that makes the Get functions include soft-deleted rows.
+//
+//	users, err := GetRdbContext[User](WithDeleted(ctx), db)
+func WithDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deletedScopeKey{}, includeDeleted)
+}
+
+// OnlyDeleted returns a context that makes the Get functions return only soft-deleted rows.
+func OnlyDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deletedScopeKey{}, onlyDeleted)
+}
+
+// HardDelete returns a context that makes the Delete functions remove rows of types with a soft-delete column
+// instead of marking them as deleted.
+//
+//	n, err := DeletePkDbContext[User](HardDelete(ctx), db, 1)
+func HardDelete(ctx context.Context) context.Context {
+	return context.WithValue(ctx, hardDeleteKey{}, true)
+}
+
+// softDeleteField returns the soft-delete column of the type, or nil if it has none.
+func (ti *typeInfo) softDeleteField() (*field, error) {
+	var sd *field
+	for _, f := range ti.fields {
+		if !f.softDelete {
+			continue
+		}
+		if sd != nil {
+			return nil, fmt.Errorf("sqlp: expected at most one soft-delete column; got %q and %q", sd.name, f.name)
+		}
+		// rows which are not deleted must be NULL
+		if f.typ != reflect.TypeOf((*time.Time)(nil)) && f.typ != reflect.TypeOf(sql.NullTime{}) {
+			return nil, fmt.Errorf("sqlp: soft-delete column %q must be a *time.Time or sql.NullTime; got %s", f.name, f.typ)
+		}
+		sd = f
+	}
+	return sd, nil
+}
+
+// selectSource returns what the Get functions select T from. For types with a soft-delete column, this is a
+// derived table filtering the rows according to the scope of ctx, so the given where clause can be used unchanged:
+//
+//	(SELECT * FROM users WHERE deleted_at IS NULL) users
+func selectSource[T Repo](ctx context.Context, db Executor) (string, error) {
+	tbl := table[T]()
+	sd, err := getTypeInfo(reflect.TypeOf((*T)(nil)).Elem()).softDeleteField()
+	if err != nil || sd == nil {
+		return quote(db, tbl), err
+	}
+
+	var cond string
+	switch scope, _ := ctx.Value(deletedScopeKey{}).(deletedScope); scope {
+	case includeDeleted:
+		return quote(db, tbl), nil
+	case onlyDeleted:
+		cond = "IS NOT NULL"
+	default:
+		cond = "IS NULL"
+	}
+	// the alias must be unqualified, e.g. "users" for "app.users"
+	alias := tbl[strings.LastIndex(tbl, ".")+1:]
+	return fmt.Sprintf("(SELECT * FROM %s WHERE %s %s) %s", quote(db, tbl), quote(db, sd.name), cond, quote(db, alias)), nil
+}
+
+// softDelete marks the row with the given primary key as deleted, unless it already is.
+// It returns false without running a statement if the row has to be removed instead.
+func softDelete[T Repo](ctx context.Context, db Executor, pkCols []string, pks []any) (bool, int64, error) {
+	sd, err := getTypeInfo(reflect.TypeOf((*T)(nil)).Elem()).softDeleteField()
+	if err != nil || sd == nil {
+		return false, 0, err
+	}
+	if hard, _ := ctx.Value(hardDeleteKey{}).(bool); hard {
+		return false, 0, nil
+	}
+
+	d := DialectOf(db)
+	tbl := table[T]()
+	query := fmt.Sprintf("UPDATE %s SET %s=? WHERE %s AND %s IS NULL", d.Quote(tbl), d.Quote(sd.name), pkWhere(d, pkCols), d.Quote(sd.name))
+	res, err := execDb(ctx, db, query, append([]any{Now()}, pks...)...)
+	if err != nil {
+		return true, 0, fmt.Errorf("sqlp: error deleting from %s: %w (query: %s)", tbl, err, query)
+	}
+	n, err := rowsAffected(res)
+	return true, n, err
+}
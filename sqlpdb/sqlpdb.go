@@ -1,15 +1,20 @@
 package sqlpdb
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/ByteSizedMarius/sqlp/sqlpdialect"
 	"github.com/ByteSizedMarius/sqlp/sqlpin"
 	"github.com/ByteSizedMarius/sqlp/sqlputil"
 	"reflect"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"time"
+	"unicode"
 )
 
 var (
@@ -20,28 +25,51 @@ var (
 	// Alternatively for a custom mapping, any func(string) string can be used instead.
 	NameMapper = strings.ToLower
 
-	// A cache of fieldInfos to save reflecting every time. Inspired by encoding/xml
-	fieldInfoCache     map[string]fieldInfo
+	// Now is the clock used for the created, updated and soft-delete columns.
+	// It can be replaced, e.g. by a function returning a fixed time in tests.
+	Now = time.Now
+
+	// A cache of typeInfos to save reflecting every time. Inspired by encoding/xml
+	typeInfoCache      map[reflect.Type]*typeInfo
 	fieldInfoCacheLock sync.RWMutex
 
 	ErrNotSet = errors.New("sqlp: database not set")
+
+	// ErrNotFound is returned by RequireAffected if a statement did not affect any rows,
+	// e.g. because the row to update or delete does not exist.
+	ErrNotFound = errors.New("sqlp: no rows affected")
+
+	// ErrStaleObject is returned by updates of types with a version column (see OptVersion) if the row was
+	// changed or deleted since the object was read.
+	ErrStaleObject = errors.New("sqlp: object is stale")
 )
 
 const (
-	// TagName is the name of the tag to use on struct fields
+	// TagName is the name of the tag to use on struct fields. Its value is the column name, optionally followed
+	// by comma-separated options (see OptPk and the following constants), e.g. `sql:"id,pk,auto"`.
 	TagName = "sql"
 
 	// AutoGenTagName is the name of the tag to use on struct fields to indicate that it is a primary key
+	// generated by the database. It is omitted from inserts. Equivalent to the options "pk,auto".
 	AutoGenTagName = "sql-auto"
 
+	// PkTagName is the name of the tag to use on struct fields to indicate that it is a primary key
+	// assigned by the application (e.g. a natural key or a client-side UUID). It is included in inserts.
+	// Equivalent to the option "pk".
+	PkTagName = "sql-pk"
+
 	// IgnoreTagName is the name of the tag to use on struct fields to indicate that it should be ignored for all operations
-	// (insert, update, delete)
-	// todo: use value of this tag to configure for which methods to ignore instead of IgnoreEditTageName
+	// (insert, update, delete). Equivalent to the option "readonly".
 	IgnoreTagName = "sql-ign"
 
-	// IgnoreEditTagName is the name of the tag to use on struct fields to indicate that it should be ignored for edit operations, but not insert
+	// IgnoreEditTagName is the name of the tag to use on struct fields to indicate that it should be ignored for edit operations, but not insert.
+	// Equivalent to the option "insertonly".
 	IgnoreEditTagName = "sql-ign-edit"
 
+	// ValidateTagName is the name of the tag to use on struct fields to declare the constraints checked before
+	// inserts and updates, e.g. `sql-validate:"required,maxlen=50"`. See ConstraintRequired and the following constants.
+	ValidateTagName = "sql-validate"
+
 	QueryReplace = "SELECT *"
 )
 
@@ -49,6 +77,15 @@ type (
 	// fieldInfo is a mapping of field tag values to their indices
 	fieldInfo map[string][]int
 
+	// pkInfo contains the column names and indices of the primary key fields in field order
+	pkInfo struct {
+		cols []string
+		idxs [][]int
+
+		// auto reports for every primary key field whether it is generated by the database
+		auto []bool
+	}
+
 	// Rows defines the interface of types that are scannable with the Scan function.
 	// It is implemented by the sql.Rows type from the standard library
 	Rows interface {
@@ -64,75 +101,246 @@ type (
 	Repo interface {
 		TableName() string
 	}
+
+	// Executor defines the interface of database handles the functions of this package run their statements on.
+	// It is implemented by *sql.DB, *sql.Tx and *sql.Conn, which allows running statements inside a transaction
+	// or on a dedicated connection.
+	//
+	// Only the context variants are part of the interface: *sql.Conn has no Exec, Query and QueryRow methods,
+	// and the functions without a context call the context variants with context.Background() anyway.
+	Executor interface {
+		ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+		QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+		QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	}
+)
+
+var (
+	_ Executor = (*sql.DB)(nil)
+	_ Executor = (*sql.Tx)(nil)
+	_ Executor = (*sql.Conn)(nil)
 )
 
 func init() {
-	fieldInfoCache = make(map[string]fieldInfo)
+	typeInfoCache = make(map[reflect.Type]*typeInfo)
+}
+
+func InsertDb[T Repo](db Executor, obj T) (int, error) {
+	return InsertDbContext[T](context.Background(), db, obj)
+}
+
+// InsertDbContext is InsertDb with a context.
+func InsertDbContext[T Repo](ctx context.Context, db Executor, obj T) (int, error) {
+	return insertHelper(ctx, db, obj, obj.TableName())
+}
+
+// InsertPtrDb inserts the object obj points to and writes the generated primary key into it.
+func InsertPtrDb[T Repo](db Executor, obj *T) error {
+	return InsertPtrDbContext[T](context.Background(), db, obj)
 }
 
-func InsertDb[T Repo](db *sql.DB, obj T) (int, error) {
-	return insertHelper(db, obj, obj.TableName())
+// InsertPtrDbContext is InsertPtrDb with a context.
+func InsertPtrDbContext[T Repo](ctx context.Context, db Executor, obj *T) error {
+	_, err := insertRow(ctx, db, obj, (*obj).TableName(), false)
+	return err
+}
+
+// InsertReturningDb inserts the object obj points to and reads all columns of the inserted row back into it,
+// including the generated primary key and columns populated by the database.
+func InsertReturningDb[T Repo](db Executor, obj *T) error {
+	return InsertReturningDbContext[T](context.Background(), db, obj)
+}
+
+// InsertReturningDbContext is InsertReturningDb with a context.
+func InsertReturningDbContext[T Repo](ctx context.Context, db Executor, obj *T) error {
+	_, err := insertRow(ctx, db, obj, (*obj).TableName(), true)
+	return err
+}
+
+// UpdateDb updates all updatable columns of the row with the primary key of obj and returns the number of
+// affected rows. Wrap the call in RequireAffected to get ErrNotFound if the row does not exist.
+func UpdateDb[T Repo](db Executor, obj T) (int64, error) {
+	return UpdateDbContext[T](context.Background(), db, obj)
+}
+
+// UpdateDbContext is UpdateDb with a context.
+func UpdateDbContext[T Repo](ctx context.Context, db Executor, obj T) (int64, error) {
+	return updateHelper(ctx, db, &obj, obj.TableName(), nil)
+}
+
+// UpdatePtrDb is UpdateDb for the object obj points to. If the type has a version column, the incremented
+// version is written into the object, so it can be updated again without reading it first.
+func UpdatePtrDb[T Repo](db Executor, obj *T) (int64, error) {
+	return UpdatePtrDbContext[T](context.Background(), db, obj)
+}
+
+// UpdatePtrDbContext is UpdatePtrDb with a context.
+func UpdatePtrDbContext[T Repo](ctx context.Context, db Executor, obj *T) (int64, error) {
+	return updateHelper(ctx, db, obj, (*obj).TableName(), nil)
+}
+
+// UpdateColumnsDb updates only the given columns of the row with the primary key of obj.
+// The columns must be mapped and must not be excluded from updates (pk, auto, readonly, insertonly).
+// As obj is a copy, the incremented version of types with a version column is lost; use UpdateColumnsPtrDb to
+// update the same object again.
+func UpdateColumnsDb[T Repo](db Executor, obj T, cols ...string) (int64, error) {
+	return UpdateColumnsDbContext[T](context.Background(), db, obj, cols...)
+}
+
+// UpdateColumnsDbContext is UpdateColumnsDb with a context.
+func UpdateColumnsDbContext[T Repo](ctx context.Context, db Executor, obj T, cols ...string) (int64, error) {
+	if len(cols) == 0 {
+		return 0, fmt.Errorf("sqlp: no columns to update")
+	}
+	return updateHelper(ctx, db, &obj, obj.TableName(), cols)
 }
 
-func UpdateDb[T Repo](db *sql.DB, obj T) error {
-	return updateHelper(db, obj, obj.TableName())
+// UpdateColumnsPtrDb is UpdateColumnsDb for the object obj points to. The incremented version of types with a
+// version column is written into the object.
+func UpdateColumnsPtrDb[T Repo](db Executor, obj *T, cols ...string) (int64, error) {
+	return UpdateColumnsPtrDbContext[T](context.Background(), db, obj, cols...)
 }
 
-func DeleteDb[T Repo](db *sql.DB, obj T) error {
+// UpdateColumnsPtrDbContext is UpdateColumnsPtrDb with a context.
+func UpdateColumnsPtrDbContext[T Repo](ctx context.Context, db Executor, obj *T, cols ...string) (int64, error) {
+	if len(cols) == 0 {
+		return 0, fmt.Errorf("sqlp: no columns to update")
+	}
+	return updateHelper(ctx, db, obj, (*obj).TableName(), cols)
+}
+
+// DeleteDb deletes the row with the primary key of obj and returns the number of affected rows.
+// Rows of types with a soft-delete column are marked as deleted instead, see OptSoftDelete.
+func DeleteDb[T Repo](db Executor, obj T) (int64, error) {
+	return DeleteDbContext[T](context.Background(), db, obj)
+}
+
+// DeleteDbContext is DeleteDb with a context.
+func DeleteDbContext[T Repo](ctx context.Context, db Executor, obj T) (int64, error) {
 	// get the pk from the object based on the tag
 	v := reflect.ValueOf(obj)
 	if v.Kind() != reflect.Struct {
-		return fmt.Errorf("sqlp: expected pointer to struct")
+		return 0, fmt.Errorf("sqlp: expected pointer to struct")
 	}
 
-	// get the name first
-	pkCol, _, err := getPkFieldInfo(v.Type())
+	// get the names first
+	_, pkIdxs, err := getPkFieldsInfo(v.Type())
 	if err != nil {
 		err = errors.Join(err, fmt.Errorf("sqlp: error getting primary key for deletion"))
-		return err
+		return 0, err
 	}
 
-	// get the value
-	pk := v.FieldByName(pkCol).Interface()
-	return deleteHelper[T](db, pk)
+	// get the values
+	pks := make([]any, len(pkIdxs))
+	for i, idx := range pkIdxs {
+		pks[i] = v.FieldByIndex(idx).Interface()
+	}
+	return deleteHelper[T](ctx, db, &obj, pks)
 }
 
-func GetRdb[T Repo](db *sql.DB) ([]T, error) {
-	query := "SELECT * FROM " + table[T]()
-	return QueryDb[T](db, query)
+func GetRdb[T Repo](db Executor) ([]T, error) {
+	return GetRdbContext[T](context.Background(), db)
 }
 
-func GetWhereRdb[T Repo](db *sql.DB, where string, args ...any) ([]T, error) {
-	query, err := whereBuilder("SELECT * FROM "+table[T](), where)
+// GetRdbContext is GetRdb with a context.
+func GetRdbContext[T Repo](ctx context.Context, db Executor) ([]T, error) {
+	src, err := selectSource[T](ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT * FROM " + src
+	return QueryDbContext[T](ctx, db, query)
+}
+
+func GetWhereRdb[T Repo](db Executor, where string, args ...any) ([]T, error) {
+	return GetWhereRdbContext[T](context.Background(), db, where, args...)
+}
+
+// GetWhereRdbContext is GetWhereRdb with a context.
+func GetWhereRdbContext[T Repo](ctx context.Context, db Executor, where string, args ...any) ([]T, error) {
+	src, err := selectSource[T](ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := whereBuilder("SELECT * FROM "+src, where)
 	if err != nil {
 		return nil, err
 	}
 
-	return QueryDb[T](db, query, args...)
+	return QueryDbContext[T](ctx, db, query, args...)
+}
+
+func GetSingleWhereRdb[T Repo](db Executor, where string, args ...any) (res T, err error) {
+	return GetSingleWhereRdbContext[T](context.Background(), db, where, args...)
 }
 
-func GetSingleWhereRdb[T Repo](db *sql.DB, where string, args ...any) (res T, err error) {
-	query, err := whereBuilder("SELECT * FROM "+table[T](), where)
+// GetSingleWhereRdbContext is GetSingleWhereRdb with a context.
+func GetSingleWhereRdbContext[T Repo](ctx context.Context, db Executor, where string, args ...any) (res T, err error) {
+	src, err := selectSource[T](ctx, db)
+	if err != nil {
+		return
+	}
+
+	query, err := whereBuilder("SELECT * FROM "+src, where)
 	if err != nil {
 		return
 	}
 
-	return QueryRowDb[T](db, query, args...)
+	return QueryRowDbContext[T](ctx, db, query, args...)
 }
 
-func GetPkDb[T Repo](db *sql.DB, id any) (res T, err error) {
+func GetPkDb[T Repo](db Executor, id any) (res T, err error) {
+	return GetPkDbContext[T](context.Background(), db, id)
+}
+
+// GetPkDbContext is GetPkDb with a context.
+func GetPkDbContext[T Repo](ctx context.Context, db Executor, id any) (res T, err error) {
+	return GetPksDbContext[T](ctx, db, id)
+}
+
+// GetPksDb retrieves the row with the given composite primary key.
+// The key parts must be given in the order of the primary key fields in the struct.
+func GetPksDb[T Repo](db Executor, pks ...any) (res T, err error) {
+	return GetPksDbContext[T](context.Background(), db, pks...)
+}
+
+// GetPksDbContext is GetPksDb with a context.
+func GetPksDbContext[T Repo](ctx context.Context, db Executor, pks ...any) (res T, err error) {
 	v := reflect.TypeOf((*T)(nil)).Elem()
-	pkCol, _, err := getPkFieldInfo(v)
+	pkCols, _, err := getPkFieldsInfo(v)
 	if err != nil {
 		err = errors.Join(err, fmt.Errorf("sqlp: error getting primary key for get"))
 		return
 	}
+	if err = checkKeys[T](pks); err != nil {
+		return
+	}
+
+	return GetSingleWhereRdbContext[T](ctx, db, "WHERE "+pkWhere(DialectOf(db), pkCols), pks...)
+}
+
+// DeletePkDb deletes the row with the given primary key and returns the number of affected rows.
+// Rows of types with a soft-delete column are marked as deleted instead, see OptSoftDelete.
+func DeletePkDb[T Repo](db Executor, id any) (int64, error) {
+	return DeletePkDbContext[T](context.Background(), db, id)
+}
 
-	return GetSingleWhereRdb[T](db, fmt.Sprintf("WHERE %s=?", pkCol), id)
+// DeletePkDbContext is DeletePkDb with a context.
+func DeletePkDbContext[T Repo](ctx context.Context, db Executor, id any) (int64, error) {
+	return deleteHelper[T](ctx, db, nil, []any{id})
 }
 
-func DeletePkDb[T Repo](db *sql.DB, id any) error {
-	return deleteHelper[T](db, id)
+// DeletePksDb deletes the row with the given composite primary key.
+// The key parts must be given in the order of the primary key fields in the struct.
+func DeletePksDb[T Repo](db Executor, pks ...any) (int64, error) {
+	return DeletePksDbContext[T](context.Background(), db, pks...)
+}
+
+// DeletePksDbContext is DeletePksDb with a context.
+func DeletePksDbContext[T Repo](ctx context.Context, db Executor, pks ...any) (int64, error) {
+	return deleteHelper[T](ctx, db, nil, pks)
 }
 
 // QueryDb executes the given query using the global database handle and returns the resulting objects in a slice.
@@ -165,9 +373,15 @@ func DeletePkDb[T Repo](db *sql.DB, id any) error {
 // and the following arguments
 //
 //	Query("SELECT * FROM users WHERE id IN (*) AND name LIKE '%?'", []int{1, 2, 3}, "a")
-func QueryDb[T any](db *sql.DB, query string, args ...any) (results []T, err error) {
-	rows, err := doQueryDb[T](db, query, args...)
-	if err != nil {
+func QueryDb[T any](db Executor, query string, args ...any) (results []T, err error) {
+	return QueryDbContext[T](context.Background(), db, query, args...)
+}
+
+// QueryDbContext is QueryDb with a context. If the context is cancelled while the rows are being scanned,
+// the context's error is returned.
+func QueryDbContext[T any](ctx context.Context, db Executor, query string, args ...any) (results []T, err error) {
+	rows, err := doQueryDb[T](ctx, db, query, args...)
+	if err != nil || rows == nil {
 		return
 	}
 
@@ -175,45 +389,52 @@ func QueryDb[T any](db *sql.DB, query string, args ...any) (results []T, err err
 		err = joinOrErr(err, rows.Close())
 	}()
 
-	results, err = sliceFromRows[T](rows)
+	results, err = sliceFromRows[T](ctx, rows)
 	return
 }
 
 // QueryRowDb works similar to Query except it returns only the first row from the result set.
 // SetDatabase must be called before using this function.
 // Check the Query function for more information.
-func QueryRowDb[T any](db *sql.DB, query string, args ...any) (result T, err error) {
-	rows, err := doQueryDb[T](db, query, args...)
+func QueryRowDb[T any](db Executor, query string, args ...any) (result T, err error) {
+	return QueryRowDbContext[T](context.Background(), db, query, args...)
+}
+
+// QueryRowDbContext is QueryRowDb with a context.
+func QueryRowDbContext[T any](ctx context.Context, db Executor, query string, args ...any) (result T, err error) {
+	rows, err := doQueryDb[T](ctx, db, query, args...)
 	if err != nil {
 		return
 	}
+	// an "IN"-query without arguments can not match any row
+	if rows == nil {
+		return result, sql.ErrNoRows
+	}
 
 	defer func() {
 		err = joinOrErr(err, rows.Close())
 	}()
 
 	if !rows.Next() {
-		err = sql.ErrNoRows
+		err = rowsErr(ctx, rows)
+		if err == nil {
+			err = sql.ErrNoRows
+		}
 		return
 	}
-	err = doScan[T](&result, rows)
+	err = doScan[T](ctx, &result, rows)
 	return
 }
 
 // QueryBasicDb is Query, but for basic data types.
-func QueryBasicDb[T string | int | int64 | float32 | float64](db *sql.DB, query string, args ...any) (results []T, err error) {
-	if strings.Contains(query, sqlpin.InQueryReplace) {
-		if len(args) == 0 {
-			return
-		}
-		query, args, err = sqlpin.InQuery(query, args)
-		if err != nil {
-			return
-		}
-	}
+func QueryBasicDb[T string | int | int64 | float32 | float64](db Executor, query string, args ...any) (results []T, err error) {
+	return QueryBasicDbContext[T](context.Background(), db, query, args...)
+}
 
-	rows, err := db.Query(query, args...)
-	if err != nil {
+// QueryBasicDbContext is QueryBasicDb with a context.
+func QueryBasicDbContext[T string | int | int64 | float32 | float64](ctx context.Context, db Executor, query string, args ...any) (results []T, err error) {
+	rows, err := doQueryBasicDb(ctx, db, query, args...)
+	if err != nil || rows == nil {
 		return
 	}
 
@@ -229,32 +450,38 @@ func QueryBasicDb[T string | int | int64 | float32 | float64](db *sql.DB, query
 		}
 		results = append(results, data)
 	}
+
+	if err = rowsErr(ctx, rows); err != nil {
+		return nil, err
+	}
 	return
 }
 
 // QueryBasicRowDb is QueryRow, but for basic data types.
-func QueryBasicRowDb[T string | int | int64 | float32 | float64](db *sql.DB, query string, args ...any) (result T, err error) {
-	if strings.Contains(query, sqlpin.InQueryReplace) {
-		if len(args) == 0 {
-			return
-		}
-		query, args, err = sqlpin.InQuery(query, args)
-		if err != nil {
-			return
-		}
-	}
+func QueryBasicRowDb[T string | int | int64 | float32 | float64](db Executor, query string, args ...any) (result T, err error) {
+	return QueryBasicRowDbContext[T](context.Background(), db, query, args...)
+}
 
-	rows, err := db.Query(query, args...)
+// QueryBasicRowDbContext is QueryBasicRowDb with a context.
+func QueryBasicRowDbContext[T string | int | int64 | float32 | float64](ctx context.Context, db Executor, query string, args ...any) (result T, err error) {
+	rows, err := doQueryBasicDb(ctx, db, query, args...)
 	if err != nil {
 		return
 	}
+	// an "IN"-query without arguments can not match any row
+	if rows == nil {
+		return result, sql.ErrNoRows
+	}
 
 	defer func() {
 		err = joinOrErr(err, rows.Close())
 	}()
 
 	if !rows.Next() {
-		err = sql.ErrNoRows
+		err = rowsErr(ctx, rows)
+		if err == nil {
+			err = sql.ErrNoRows
+		}
 		return
 	}
 
@@ -265,232 +492,441 @@ func QueryBasicRowDb[T string | int | int64 | float32 | float64](db *sql.DB, que
 	return result, nil
 }
 
-func InDb(db *sql.DB, query string, args ...any) (err error) {
+// RequireAffected returns ErrNotFound if the statement succeeded, but did not affect any rows.
+//
+//	err := RequireAffected(DeletePkDb[User](db, 1))
+func RequireAffected(n int64, err error) error {
+	if err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+func InDb(db Executor, query string, args ...any) (err error) {
+	return InDbContext(context.Background(), db, query, args...)
+}
+
+// InDbContext is InDb with a context.
+func InDbContext(ctx context.Context, db Executor, query string, args ...any) (err error) {
+	if isNil(db) {
+		return ErrNotSet
+	}
 	if !strings.Contains(query, sqlpin.InQueryReplace) {
 		panic("sqlstruct: in query not found")
 	}
 
-	query, args, err = sqlpin.InQuery(query, args)
+	query, args, err = sqlpin.InQueryDialect(DialectOf(db), query, args)
 	if err != nil {
 		return
 	}
 
-	_, err = db.Exec(query, args...)
+	_, err = execDb(ctx, db, query, args...)
 	return err
 }
 
-func insertHelper[T any](db *sql.DB, obj T, table string) (int, error) {
-	if db == nil {
-		return 0, ErrNotSet
+func insertHelper[T any](ctx context.Context, db Executor, obj T, table string) (int, error) {
+	key, err := insertRow(ctx, db, &obj, table, false)
+	if err != nil || key == nil {
+		return 0, err
 	}
 
-	columnString, values, err := prepareInsert[T](obj)
+	// keys which are not integers were assigned by the application, there is nothing to return
+	switch v := reflect.Indirect(reflect.ValueOf(key)); v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint()), nil
+	}
+	return 0, nil
+}
+
+// insertRow inserts the object obj points to and returns its primary key.
+// If the primary key is generated by the database, it is written into the object. If the type has no
+// primary key, the value of LastInsertId is returned if the dialect supports it. For composite primary keys,
+// nil is returned.
+// If reread is set, all columns are read back into the object after the insert, which makes values populated by
+// the database (e.g. defaults) visible. Depending on the dialect, this is done using the insert statement itself
+// or using a second query.
+func insertRow[T any](ctx context.Context, db Executor, obj *T, table string, reread bool) (any, error) {
+	if isNil(db) {
+		return nil, ErrNotSet
+	}
+
+	if err := beforeInsert(ctx, obj); err != nil {
+		return nil, err
+	}
+
+	colNames, values, err := prepareInsert[T](obj)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, columnString, sqlputil.BuildPlaceholders(len(values)))
 
-	res, err := db.Exec(query, values...)
+	d := DialectOf(db)
+	k := d.KeyRetrieval()
+	destv := reflect.ValueOf(obj).Elem()
+	pinfo := getPkInfo(destv.Type())
+	autoCol, autoIdx, generated, err := pinfo.generated()
 	if err != nil {
-		return 0, fmt.Errorf("sqlp: error inserting into %s: %w (query: %s)", table, err, query)
+		return nil, err
+	}
+	if reread && len(pinfo.cols) == 0 {
+		return nil, fmt.Errorf("sqlp: expected at least one primary key to read the inserted row; got 0")
+	}
+
+	// the columns returned by the statement itself
+	var returnCols []string
+	scanAll := reread && (k == sqlpdialect.Returning || k == sqlpdialect.OutputInserted)
+	if scanAll {
+		returnCols = getColumns[T](true, true, false, false)
+	} else if generated && k != sqlpdialect.LastInsertId {
+		returnCols = []string{autoCol}
+	}
+
+	query := insertQuery(d, table, colNames, len(values), returnCols)
+
+	var key any
+	switch {
+	case scanAll:
+		err = insertScan(ctx, db, obj, query, values)
+	case generated && (k == sqlpdialect.Returning || k == sqlpdialect.OutputInserted):
+		err = queryRowDb(ctx, db, query, values...).Scan(destv.FieldByIndex(autoIdx).Addr().Interface())
+	case generated && k == sqlpdialect.ReturningInto:
+		_, err = execDb(ctx, db, query, append(values, sql.Out{Dest: destv.FieldByIndex(autoIdx).Addr().Interface()})...)
+	default:
+		var res sql.Result
+		res, err = execDb(ctx, db, query, values...)
+		// without a primary key, LastInsertId is only used if the dialect retrieves keys this way
+		if err != nil || (!generated && (len(pinfo.cols) > 0 || k != sqlpdialect.LastInsertId)) {
+			break
+		}
+
+		var id int64
+		id, err = res.LastInsertId()
+		if err != nil {
+			return nil, fmt.Errorf("sqlp: error getting last inserted id: %w", err)
+		}
+		if !generated {
+			key = id
+			break
+		}
+		err = setInt(destv.FieldByIndex(autoIdx), id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sqlp: error inserting into %s: %w (query: %s)", table, err, query)
+	}
+
+	if len(pinfo.cols) == 1 {
+		key = destv.FieldByIndex(pinfo.idxs[0]).Interface()
+	}
+
+	if reread && !scanAll {
+		pks := make([]any, len(pinfo.idxs))
+		for i, idx := range pinfo.idxs {
+			pks[i] = destv.FieldByIndex(idx).Interface()
+		}
+
+		query = fmt.Sprintf("SELECT * FROM %s WHERE %s", d.Quote(table), pkWhere(d, pinfo.cols))
+		*obj, err = QueryRowDbContext[T](ctx, db, query, pks...)
+		if err != nil {
+			return nil, fmt.Errorf("sqlp: error reading inserted row from %s: %w", table, err)
+		}
+	}
+
+	if err = afterInsert(ctx, obj); err != nil {
+		return nil, err
 	}
-	id, err := res.LastInsertId()
+	return key, nil
+}
+
+// insertScan runs the insert statement and scans the returned row into obj.
+func insertScan[T any](ctx context.Context, db Executor, obj *T, query string, values []any) (err error) {
+	rows, err := queryDb(ctx, db, query, values...)
 	if err != nil {
-		return 0, fmt.Errorf("sqlp: error getting last inserted id: %w", err)
+		return
 	}
 
-	return int(id), nil
+	defer func() {
+		err = joinOrErr(err, rows.Close())
+	}()
+
+	if !rows.Next() {
+		err = rowsErr(ctx, rows)
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return
+	}
+	return doScan[T](ctx, obj, rows)
 }
 
-func updateHelper[T any](db *sql.DB, obj T, table string) error {
-	if db == nil {
-		panic(ErrNotSet)
+// setInt sets the integer field v to the given id.
+func setInt(v reflect.Value, id int64) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(id)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(id))
+	default:
+		return fmt.Errorf("sqlp: cannot set last inserted id on primary key of type %s", v.Type())
 	}
-	columnString, values, pkCol, err := prepareUpdate[T](obj)
+	return nil
+}
+
+// insertQuery builds the insert statement for the given columns. If returnCols is set, the statement returns
+// these columns in the way defined by the dialect's KeyRetrieval.
+func insertQuery(d sqlpdialect.Dialect, table string, colNames []string, n int, returnCols []string) string {
+	var output, returning string
+	if len(returnCols) > 0 {
+		switch d.KeyRetrieval() {
+		case sqlpdialect.Returning:
+			returning = " RETURNING " + quoteJoinDialect(d, returnCols, ", ")
+		case sqlpdialect.OutputInserted:
+			output = " OUTPUT INSERTED." + quoteJoinDialect(d, returnCols, ", INSERTED.")
+		case sqlpdialect.ReturningInto:
+			returning = " RETURNING " + quoteJoinDialect(d, returnCols, ", ") + " INTO ?"
+		}
+	}
+
+	return fmt.Sprintf("INSERT INTO %s (%s)%s VALUES (%s)%s", d.Quote(table), quoteJoinDialect(d, colNames, ", "), output, sqlputil.BuildPlaceholders(n), returning)
+}
+
+// updateHelper updates the row with the primary key of obj. If cols is nil, all updatable columns are written.
+// If the type has a version column, only the row with the version of obj is updated and the version is
+// incremented, both in the database and in obj. ErrStaleObject is returned if no row matched.
+func updateHelper[T any](ctx context.Context, db Executor, obj *T, table string, cols []string) (int64, error) {
+	if isNil(db) {
+		return 0, ErrNotSet
+	}
+	if err := beforeUpdate(ctx, obj); err != nil {
+		return 0, err
+	}
+
+	colNames, values, pkCols, err := prepareUpdate[T](obj, cols)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s=?", table, columnString, pkCol)
+	destv := reflect.ValueOf(obj).Elem()
+	ver, err := getTypeInfo(destv.Type()).versionField()
+	if err != nil {
+		return 0, err
+	}
 
-	_, err = db.Exec(query, values...)
+	d := DialectOf(db)
+	set := make([]string, 0, len(colNames)+1)
+	for _, c := range colNames {
+		set = append(set, d.Quote(c)+"=?")
+	}
+	where := pkWhere(d, pkCols)
+	if ver != nil {
+		c := d.Quote(ver.name)
+		set = append(set, c+"="+c+"+1")
+		where += " AND " + c + "=?"
+		values = append(values, destv.FieldByIndex(ver.index).Interface())
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", d.Quote(table), strings.Join(set, ", "), where)
+
+	res, err := execDb(ctx, db, query, values...)
 	if err != nil {
-		return fmt.Errorf("sqlp: error updating %s: %w (query: %s)", table, err, query)
+		return 0, fmt.Errorf("sqlp: error updating %s: %w (query: %s)", table, err, query)
 	}
-	return nil
+	n, err := rowsAffected(res)
+	if err != nil {
+		return 0, err
+	}
+	if ver != nil {
+		if n == 0 {
+			return 0, ErrStaleObject
+		}
+		incVersion(destv.FieldByIndex(ver.index))
+	}
+
+	return n, afterUpdate(ctx, obj)
 }
 
-func deleteHelper[T Repo](db *sql.DB, pk any) error {
-	if db == nil {
-		return ErrNotSet
+// deleteHelper deletes the row with the given primary key. obj is passed to the BeforeDelete hook; if it is nil,
+// an object with the primary key values is created for it.
+func deleteHelper[T Repo](ctx context.Context, db Executor, obj *T, pks []any) (int64, error) {
+	if isNil(db) {
+		return 0, ErrNotSet
 	}
 	v := reflect.TypeOf((*T)(nil)).Elem()
 	if v.Kind() != reflect.Struct {
-		return fmt.Errorf("dest must a struct; got %T", v)
+		return 0, fmt.Errorf("dest must a struct; got %T", v)
 	}
-	pkCol, _, err := getPkFieldInfo(v)
+	pkCols, pkIdxs, err := getPkFieldsInfo(v)
 	if err != nil {
 		err = errors.Join(err, fmt.Errorf("sqlp: error getting primary key for deletion"))
-		return err
+		return 0, err
+	}
+	if err = checkKeys[T](pks); err != nil {
+		return 0, err
+	}
+	if err = beforeDelete(ctx, obj, pkIdxs, pks); err != nil {
+		return 0, err
+	}
+
+	if soft, n, err := softDelete[T](ctx, db, pkCols, pks); soft || err != nil {
+		return n, err
 	}
 
 	tbl := table[T]()
-	query := fmt.Sprintf("DELETE FROM %s WHERE %s=?", tbl, pkCol)
-	_, err = db.Exec(query, pk)
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s", quote(db, tbl), pkWhere(DialectOf(db), pkCols))
+	res, err := execDb(ctx, db, query, pks...)
 	if err != nil {
-		return fmt.Errorf("sqlp: error deleting from %s: %w (query: %s)", tbl, err, query)
+		return 0, fmt.Errorf("sqlp: error deleting from %s: %w (query: %s)", tbl, err, query)
 	}
-	return nil
+	return rowsAffected(res)
+}
+
+// rowsAffected returns the number of rows affected by the statement.
+func rowsAffected(res sql.Result) (int64, error) {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("sqlp: error getting rows affected: %w", err)
+	}
+	return n, nil
 }
 
 // --------
 
-func doQueryDb[T any](db *sql.DB, query string, args ...any) (rows *sql.Rows, err error) {
-	if db == nil {
+func doQueryDb[T any](ctx context.Context, db Executor, query string, args ...any) (rows *sql.Rows, err error) {
+	query = strings.Replace(query, QueryReplace, "SELECT "+columns[T](DialectOf(db)), 1)
+	return doQueryBasicDb(ctx, db, query, args...)
+}
+
+// doQueryBasicDb expands "IN"-queries and runs the query. If the query contains an "IN"-query but no
+// arguments were given, no query is run and rows is nil.
+func doQueryBasicDb(ctx context.Context, db Executor, query string, args ...any) (rows *sql.Rows, err error) {
+	if isNil(db) {
 		return nil, ErrNotSet
 	}
 
-	query = strings.Replace(query, QueryReplace, "SELECT "+columns[T](), 1)
 	if strings.Contains(query, sqlpin.InQueryReplace) {
 		if len(args) == 0 {
 			return
 		}
-		query, args, err = sqlpin.InQuery(query, args)
+		query, args, err = sqlpin.InQueryDialect(DialectOf(db), query, args)
 		if err != nil {
 			return
 		}
 	}
 
-	rows, err = db.Query(query, args...)
-	if err != nil {
-		return
-	}
-
-	return
+	return queryDb(ctx, db, query, args...)
 }
 
 // sliceFromRows returns a slice of structs from the given rows by calling Scan on each row.
-func sliceFromRows[T any](rows *sql.Rows) (slice []T, err error) {
-	for rows.Next() {
-		var stru T
-		err = doScan[T](&stru, rows)
-		if err != nil {
-			return
-		}
-
+// If the context is cancelled during the iteration, the context's error is returned.
+func sliceFromRows[T any](ctx context.Context, rows *sql.Rows) (slice []T, err error) {
+	err = eachRow[T](ctx, rows, func(stru T) error {
 		slice = append(slice, stru)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-
 	return
 }
 
-func getPkFieldInfo(typ reflect.Type) (string, []int, error) {
-	fieldInfoCacheLock.RLock()
-	finfo, ok := fieldInfoCache[typ.String()+AutoGenTagName]
-	fieldInfoCacheLock.RUnlock()
-
-	// if not cached, get the primary key field by reflection
-	if !ok {
-		finfo = make(fieldInfo)
-		n := typ.NumField()
-		for i := 0; i < n; i++ {
-			f := typ.Field(i)
-			_, isPk := f.Tag.Lookup(AutoGenTagName)
-			if !isPk {
-				continue
-			}
-			finfo[f.Name] = []int{i}
+// eachRow scans the rows one at a time and calls fn for each of them. If fn returns an error, the iteration
+// stops and the error is returned. If the context is cancelled during the iteration, the context's error is returned.
+func eachRow[T any](ctx context.Context, rows *sql.Rows, fn func(T) error) error {
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
 
-		if len(finfo) != 1 {
-			return "", nil, fmt.Errorf("sqlp: expected exactly one primary key; got %d", len(finfo))
+		var stru T
+		if err := doScan[T](ctx, &stru, rows); err != nil {
+			return err
+		}
+		if err := fn(stru); err != nil {
+			return err
 		}
 	}
 
-	// ToDo: 1.23?
-	// https://github.com/golang/go/issues/61900
-	for col, idx := range finfo {
-		return col, idx, nil
-	}
+	return rowsErr(ctx, rows)
+}
 
-	return "", nil, nil
+// rowsErr returns the error encountered during the iteration of rows.
+// If the context was cancelled, the context's error is returned instead of the driver-specific one.
+func rowsErr(ctx context.Context, rows *sql.Rows) error {
+	err := rows.Err()
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
 }
 
-// getFieldInfo creates a fieldInfo for the provided type. Fields that are not tagged
-// with the "sql" tag and unexported fields are not included.
-func getFieldInfo(typ reflect.Type, includePk bool, applyIgnore bool, applyIgnoreEdit bool) fieldInfo {
-	key := fmt.Sprintf("%s%s%t%t%t", typ.String(), TagName, includePk, applyIgnore, applyIgnoreEdit)
-	fieldInfoCacheLock.RLock()
-	finfo, ok := fieldInfoCache[key]
-	fieldInfoCacheLock.RUnlock()
-	if ok {
-		return finfo
+// getPkFieldInfo returns the column name and field index of the primary key of the given type.
+// It returns an error if the type does not have exactly one primary key field.
+func getPkFieldInfo(typ reflect.Type) (string, []int, error) {
+	cols, idxs, err := getPkFieldsInfo(typ)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(cols) != 1 {
+		return "", nil, fmt.Errorf("sqlp: expected exactly one primary key; got %d", len(cols))
 	}
+	return cols[0], idxs[0], nil
+}
 
-	finfo = make(fieldInfo)
+// getPkFieldsInfo returns the column names and field indices of all primary key fields of the given type,
+// in the order of the fields in the struct.
+func getPkFieldsInfo(typ reflect.Type) ([]string, [][]int, error) {
+	pinfo := getPkInfo(typ)
+	if len(pinfo.cols) == 0 {
+		return nil, nil, fmt.Errorf("sqlp: expected at least one primary key; got 0")
+	}
+	return pinfo.cols, pinfo.idxs, nil
+}
 
-	n := typ.NumField()
-	for i := 0; i < n; i++ {
-		f := typ.Field(i)
-		tag := f.Tag.Get(TagName)
+// getPkInfo returns the pkInfo of the given type.
+func getPkInfo(typ reflect.Type) pkInfo {
+	return getTypeInfo(typ).pk
+}
 
-		// Skip unexported fields or fields marked with "-"
-		if f.PkgPath != "" || tag == "-" {
+// generated returns the column name and field index of the primary key generated by the database.
+// ok is false if the type has no generated primary key.
+func (p pkInfo) generated() (col string, idx []int, ok bool, err error) {
+	for i, auto := range p.auto {
+		if !auto {
 			continue
 		}
-
-		if !includePk {
-			_, isPk := f.Tag.Lookup(AutoGenTagName)
-			if isPk {
-				continue
-			}
-		}
-
-		if applyIgnore {
-			_, shouldIgnore := f.Tag.Lookup(IgnoreTagName)
-			if shouldIgnore {
-				continue
-			}
-		}
-
-		if applyIgnoreEdit {
-			_, shouldIgnoreEdit := f.Tag.Lookup(IgnoreEditTagName)
-			if shouldIgnoreEdit {
-				continue
-			}
+		if ok {
+			return "", nil, false, fmt.Errorf("sqlp: expected at most one generated primary key")
 		}
+		col, idx, ok = p.cols[i], p.idxs[i], true
+	}
+	return
+}
 
-		// Handle embedded structs
-		if f.Anonymous && f.Type.Kind() == reflect.Struct {
-			scannerType := reflect.TypeOf((*Scanner)(nil)).Elem()
-			if !reflect.PointerTo(f.Type).Implements(scannerType) {
-				for k, v := range getFieldInfo(f.Type, includePk, applyIgnore, applyIgnoreEdit) {
-					finfo[k] = append([]int{i}, v...)
-				}
-				continue
-			}
-		}
+// pkWhere returns the condition matching the given primary key columns, e.g. "a=? AND b=?".
+func pkWhere(d sqlpdialect.Dialect, pkCols []string) string {
+	return quoteJoinDialect(d, pkCols, "=? AND ") + "=?"
+}
 
-		// Use field name for untagged fields
-		if tag == "" {
-			tag = f.Name
+// getFieldInfo creates a fieldInfo for the provided type. Fields that are not tagged
+// with the "sql" tag and unexported fields are not included.
+// Generated fields (auto) are only included if includeAuto is set, other primary keys only if includePk is set.
+// If applyIgnore is set, readonly fields are not included, if applyIgnoreEdit is set, insertonly fields are not included.
+func getFieldInfo(typ reflect.Type, includeAuto bool, includePk bool, applyIgnore bool, applyIgnoreEdit bool) fieldInfo {
+	ti := getTypeInfo(typ)
+	finfo := make(fieldInfo, len(ti.fields))
+	for _, f := range ti.fields {
+		if (!includeAuto && f.auto) || (!includePk && f.pk && !f.auto) || (applyIgnore && f.readonly) || (applyIgnoreEdit && f.insertOnly) {
+			continue
 		}
-		tag = NameMapper(tag)
-		finfo[tag] = []int{i}
+		finfo[f.name] = f.index
 	}
-
-	// Update cache
-	fieldInfoCacheLock.Lock()
-	fieldInfoCache[key] = finfo
-	fieldInfoCacheLock.Unlock()
-
 	return finfo
 }
 
 // doScan scans the next row from rows in to a struct pointed to by dest.
 // The mapping of columns to struct fields is done by matching the column name to the
-// struct field name or given tag.
-func doScan[T any](dest *T, rows Rows) error {
+// struct field name or given tag. Afterward, the AfterScan hook of dest is called.
+func doScan[T any](ctx context.Context, dest *T, rows Rows) error {
 	// reflect the value and check if dest is of the correct type
 	destv := reflect.ValueOf(dest)
 	typ := destv.Type()
@@ -498,8 +934,8 @@ func doScan[T any](dest *T, rows Rows) error {
 		return fmt.Errorf("dest must be pointer to struct; got %T", destv)
 	}
 
-	// Get the dest's fieldInfo. FieldInfo maps the sql-tag to the fields index.
-	fInfo := getFieldInfo(typ.Elem(), true, false, false)
+	// Get the dest's typeInfo. It maps the column names to the fields.
+	ti := getTypeInfo(typ.Elem())
 
 	// Get the columns contained in the row
 	cols, err := rows.Columns()
@@ -513,12 +949,12 @@ func doScan[T any](dest *T, rows Rows) error {
 	for _, cName := range cols {
 
 		// Get the field index for the column
-		idx, isMapped := fInfo[NameMapper(cName)]
+		f, isMapped := ti.byName[NameMapper(cName)]
 		var v any
 
 		// Check if the column is mapped to a field
 		if isMapped {
-			v = elem.FieldByIndex(idx).Addr().Interface()
+			v = elem.FieldByIndex(f.index).Addr().Interface()
 		} else {
 			// Discard the field. Needs to still be scanned because scanning is based on index.
 			v = &sql.RawBytes{}
@@ -527,13 +963,16 @@ func doScan[T any](dest *T, rows Rows) error {
 		ptrsToScanInto = append(ptrsToScanInto, v)
 	}
 
-	return rows.Scan(ptrsToScanInto...)
+	if err = rows.Scan(ptrsToScanInto...); err != nil {
+		return err
+	}
+	return afterScan(ctx, dest)
 }
 
-func getColumns[T any](includePk bool, applyIgnore bool, applyIgnoreEdit bool) []string {
+func getColumns[T any](includeAuto bool, includePk bool, applyIgnore bool, applyIgnoreEdit bool) []string {
 	// ToDo: use reflect.TypeFor here, starting with Go 1.22 (?)
 	var v = reflect.TypeOf((*T)(nil))
-	fields := getFieldInfo(v.Elem(), includePk, applyIgnore, applyIgnoreEdit)
+	fields := getFieldInfo(v.Elem(), includeAuto, includePk, applyIgnore, applyIgnoreEdit)
 
 	names := make([]string, 0, len(fields))
 	for f := range fields {
@@ -546,6 +985,15 @@ func getColumns[T any](includePk bool, applyIgnore bool, applyIgnoreEdit bool) [
 	return names
 }
 
+// isNil reports whether db is nil or a nil pointer wrapped in the interface (e.g. an unset *sql.DB).
+func isNil(db Executor) bool {
+	if db == nil {
+		return true
+	}
+	v := reflect.ValueOf(db)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
 func joinOrErr(err, nErr error) error {
 	if nErr != nil {
 		if err == nil {
@@ -557,54 +1005,115 @@ func joinOrErr(err, nErr error) error {
 	return err
 }
 
-func prepareInsert[T any](src T) (string, []any, error) {
-	colNames, values, _, err := prepareColumns(src, false, false, false)
+// prepareInsert returns the columns and values written by an insert of src.
+// Fields with the omitempty option are skipped if they have their zero value.
+// The created and updated columns are set to the current time before. The constraints of the inserted columns
+// are checked, as auto and readonly columns are not set by the application.
+func prepareInsert[T any](src *T) ([]string, []any, error) {
+	if err := setTimestamps(reflect.ValueOf(src).Elem(), true); err != nil {
+		return nil, nil, err
+	}
+
+	colNames, values, _, err := prepareColumns(*src, (*field).insertable, true, false)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
-	return strings.Join(colNames, ", "), values, nil
+	if err = validate(reflect.ValueOf(src).Elem(), colNames); err != nil {
+		return nil, nil, err
+	}
+	return colNames, values, nil
 }
 
-func prepareUpdate[T any](src T) (string, []any, string, error) {
-	colNames, values, pkCol, err := prepareColumns(src, false, true, true)
+// prepareUpdate returns the columns and values written by an update of src, followed by the values of the
+// primary key columns. If cols is not nil, only the given columns and the updated columns are written.
+// The updated columns are set to the current time before. The constraints of the written columns are checked.
+func prepareUpdate[T any](src *T, cols []string) ([]string, []any, []string, error) {
+	include := (*field).updatable
+	if cols != nil {
+		ti := getTypeInfo(reflect.TypeOf(*src))
+		for _, c := range cols {
+			f, ok := ti.byName[c]
+			if !ok {
+				return nil, nil, nil, fmt.Errorf("sqlp: unknown column %q for %T", c, *src)
+			}
+			if !f.updatable() {
+				return nil, nil, nil, fmt.Errorf("sqlp: column %q of %T can not be updated", c, *src)
+			}
+		}
+		include = func(f *field) bool {
+			return f.updatable() && (f.updated || slices.Contains(cols, f.name))
+		}
+	}
+
+	if err := setTimestamps(reflect.ValueOf(src).Elem(), false); err != nil {
+		return nil, nil, nil, err
+	}
+
+	colNames, values, pkCols, err := prepareColumns(*src, include, false, true)
 	if err != nil {
-		return "", nil, "", err
+		return nil, nil, nil, err
 	}
+	if err = validate(reflect.ValueOf(src).Elem(), colNames); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return colNames, values, pkCols, nil
+}
 
-	return strings.Join(colNames, "=?,") + "=?", values, pkCol, nil
+// quoteJoinDialect quotes the identifiers using the dialect and joins them using sep.
+func quoteJoinDialect(d sqlpdialect.Dialect, idents []string, sep string) string {
+	quoted := make([]string, len(idents))
+	for i, ident := range idents {
+		quoted[i] = d.Quote(ident)
+	}
+	return strings.Join(quoted, sep)
 }
 
-func prepareColumns[T any](src T, includePk bool, pkLast bool, applyIgnoreEdit bool) ([]string, []any, string, error) {
-	// Get the dest's fieldInfo. FieldInfo maps the sql-tag to the fields index.
+// prepareColumns returns the names and values of the fields of src for which include returns true, in field order.
+// If omitEmpty is set, fields with the omitempty option are skipped if they have their zero value.
+// If pkLast is set, the values of the primary key fields are appended to the values and their names returned.
+func prepareColumns[T any](src T, include func(*field) bool, omitEmpty bool, pkLast bool) ([]string, []any, []string, error) {
+	// Get the dest's typeInfo. It contains the metadata of all mapped fields.
 	destv, typ, err := rft(src)
 	if err != nil {
-		return nil, nil, "", err
+		return nil, nil, nil, err
 	}
-	fInfo := getFieldInfo(typ, includePk, true, applyIgnoreEdit)
+	ti := getTypeInfo(typ)
+
+	colNames := make([]string, 0, len(ti.fields))
+	values := make([]any, 0, len(ti.fields))
+	for _, f := range ti.fields {
+		if !include(f) {
+			continue
+		}
+
+		v := destv.FieldByIndex(f.index)
+		if omitEmpty && f.omitEmpty && v.IsZero() {
+			continue
+		}
 
-	colNames := make([]string, 0, len(fInfo))
-	values := make([]any, 0, len(fInfo))
-	for col, idx := range fInfo {
 		// add the column name to the column names slice
-		colNames = append(colNames, col)
+		colNames = append(colNames, f.name)
 
 		// add the value to the values slice
-		values = append(values, destv.FieldByIndex(idx).Interface())
+		values = append(values, v.Interface())
 	}
 
-	// get the primary key column and value
-	var pkCol string
+	// get the primary key columns and values
+	var pkCols []string
 	if pkLast {
-		var pkIdx []int
-		pkCol, pkIdx, err = getPkFieldInfo(typ)
+		var pkIdxs [][]int
+		pkCols, pkIdxs, err = getPkFieldsInfo(typ)
 		if err != nil {
-			err = errors.Join(err, fmt.Errorf("sqlp: error getting primary key for deletion"))
-			return nil, nil, "", err
+			err = errors.Join(err, fmt.Errorf("sqlp: error getting primary key for update"))
+			return nil, nil, nil, err
+		}
+		for _, idx := range pkIdxs {
+			values = append(values, destv.FieldByIndex(idx).Interface())
 		}
-		values = append(values, destv.FieldByIndex(pkIdx).Interface())
 	}
 
-	return colNames, values, pkCol, nil
+	return colNames, values, pkCols, nil
 }
 
 func rft[T any](src T) (reflect.Value, reflect.Type, error) {
@@ -619,8 +1128,8 @@ func rft[T any](src T) (reflect.Value, reflect.Type, error) {
 
 // columns returns a string containing a sorted, comma-separated list of column names as
 // defined by the type s. s must be a struct that has exported fields tagged with the "sql" tag.
-func columns[T any]() string {
-	return strings.Join(getColumns[T](true, false, false), ", ")
+func columns[T any](d sqlpdialect.Dialect) string {
+	return quoteJoinDialect(d, getColumns[T](true, true, false, false), ", ")
 }
 
 func whereBuilder(query string, where string) (string, error) {
@@ -634,6 +1143,23 @@ func whereBuilder(query string, where string) (string, error) {
 	return query + " " + where, nil
 }
 
+// ToSnakeCase converts a CamelCase field name to snake_case. It can be used as NameMapper.
+func ToSnakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// start a new word if the previous rune is lower case or if this is the last upper case rune of an acronym
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 func table[T Repo]() string {
 	var instance T
 	instanceType := reflect.TypeOf(instance)
@@ -0,0 +1,116 @@
+package sqlpdb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// UpsertOptions configures UpsertDb.
+type UpsertOptions struct {
+	// Conflict are the columns of the unique constraint that identifies existing rows. They must be written by
+	// the insert; generated primary keys are inserted if they are set. Defaults to the primary key columns.
+	// Ignored by MySQL, which checks all unique keys.
+	Conflict []string
+
+	// Update are the columns that are updated if the row exists. They must be written by the insert.
+	// Defaults to all inserted columns which are not part of Conflict and not excluded from updates.
+	Update []string
+
+	// DoNothing leaves existing rows unchanged instead of updating them.
+	DoNothing bool
+}
+
+// UpsertDb inserts the object or updates the existing row if it conflicts with the conflict columns,
+// using "ON CONFLICT ... DO UPDATE" (SQLite, PostgreSQL) or "ON DUPLICATE KEY UPDATE" (MySQL).
+// The zero value of UpsertOptions uses the primary key as conflict columns and updates all other columns.
+func UpsertDb[T Repo](db Executor, obj T, opts UpsertOptions) error {
+	return UpsertDbContext[T](context.Background(), db, obj, opts)
+}
+
+// UpsertDbContext is UpsertDb with a context.
+func UpsertDbContext[T Repo](ctx context.Context, db Executor, obj T, opts UpsertOptions) error {
+	if isNil(db) {
+		return ErrNotSet
+	}
+
+	if err := beforeInsert(ctx, &obj); err != nil {
+		return err
+	}
+
+	colNames, values, err := prepareInsert[T](&obj)
+	if err != nil {
+		return err
+	}
+
+	// generated keys are omitted from inserts, but a set key identifies the row to update
+	v := reflect.ValueOf(obj)
+	ti := getTypeInfo(v.Type())
+	for i := len(ti.pk.cols) - 1; i >= 0; i-- {
+		if f := v.FieldByIndex(ti.pk.idxs[i]); ti.pk.auto[i] && !f.IsZero() {
+			colNames = append([]string{ti.pk.cols[i]}, colNames...)
+			values = append([]any{f.Interface()}, values...)
+		}
+	}
+
+	conflict, update, err := upsertColumns(reflect.TypeOf(obj), colNames, opts)
+	if err != nil {
+		return err
+	}
+
+	d := DialectOf(db)
+	clause, err := d.Upsert(conflict, update)
+	if err != nil {
+		return fmt.Errorf("sqlp: error building upsert for %s: %w", d.Name(), err)
+	}
+
+	tbl := obj.TableName()
+	query := insertQuery(d, tbl, colNames, len(values), nil) + " " + clause
+	if _, err = execDb(ctx, db, query, values...); err != nil {
+		return fmt.Errorf("sqlp: error upserting into %s: %w (query: %s)", tbl, err, query)
+	}
+	return afterInsert(ctx, &obj)
+}
+
+// upsertColumns validates the conflict and update columns of the options and fills in the defaults.
+func upsertColumns(typ reflect.Type, inserted []string, opts UpsertOptions) (conflict []string, update []string, err error) {
+	ti := getTypeInfo(typ)
+
+	conflict = opts.Conflict
+	if len(conflict) == 0 {
+		conflict = ti.pk.cols
+	}
+	for _, c := range conflict {
+		if _, ok := ti.byName[c]; !ok {
+			return nil, nil, fmt.Errorf("sqlp: unknown conflict column %q for %s", c, typ)
+		}
+		// a row can only conflict with the values that are inserted
+		if !slices.Contains(inserted, c) {
+			return nil, nil, fmt.Errorf("sqlp: conflict column %q is not inserted for %s", c, typ)
+		}
+	}
+
+	if opts.DoNothing {
+		return conflict, nil, nil
+	}
+
+	if len(opts.Update) > 0 {
+		for _, c := range opts.Update {
+			if !slices.Contains(inserted, c) {
+				return nil, nil, fmt.Errorf("sqlp: update column %q is not inserted for %s", c, typ)
+			}
+		}
+		return conflict, opts.Update, nil
+	}
+
+	for _, c := range inserted {
+		if !slices.Contains(conflict, c) && ti.byName[c].updatable() {
+			update = append(update, c)
+		}
+	}
+	if len(update) == 0 {
+		return nil, nil, fmt.Errorf("sqlp: no columns to update for %s", typ)
+	}
+	return conflict, update, nil
+}
@@ -0,0 +1,217 @@
+package sqlpdb
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Constraints of the sql-validate tag. They are checked before objects are inserted or updated and given as
+// comma-separated list, e.g. `sql-validate:"required,maxlen=50"`. As regular expressions may contain commas,
+// the regex constraint must be the last one.
+const (
+	// ConstraintRequired rejects zero values, e.g. empty strings or nil pointers.
+	ConstraintRequired = "required"
+
+	// ConstraintMaxLen limits the number of characters of strings and the length of slices, e.g. "maxlen=50".
+	ConstraintMaxLen = "maxlen"
+
+	// ConstraintMin rejects numbers lower than the given one, e.g. "min=0".
+	ConstraintMin = "min"
+
+	// ConstraintMax rejects numbers greater than the given one, e.g. "max=100".
+	ConstraintMax = "max"
+
+	// ConstraintRegex rejects strings not matching the regular expression, e.g. "regex=^[a-z]+$".
+	ConstraintRegex = "regex"
+
+	// ConstraintEnum rejects values not contained in the list separated by "|", e.g. "enum=draft|published".
+	ConstraintEnum = "enum"
+)
+
+type (
+	// Validator is implemented by types which validate themselves before they are inserted or updated.
+	// Validate is called after the tag constraints were checked.
+	Validator interface {
+		Validate() error
+	}
+
+	// ValidationError is returned if an object fails validation. It lists every failing column.
+	ValidationError struct {
+		// Columns are the failing tag constraints, in field order.
+		Columns []ColumnError
+
+		// Err is the error returned by the Validate method, if any.
+		Err error
+	}
+
+	// ColumnError describes a column that failed a tag constraint.
+	ColumnError struct {
+		Column     string
+		Constraint string
+		Message    string
+	}
+
+	// constraint is a parsed constraint of the sql-validate tag.
+	constraint struct {
+		name string
+		arg  string
+
+		num  float64
+		re   *regexp.Regexp
+		enum []string
+
+		// err is set if the argument is invalid, it is reported by every validation
+		err error
+	}
+)
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Columns)+1)
+	for _, c := range e.Columns {
+		msgs = append(msgs, c.Column+": "+c.Message)
+	}
+	if e.Err != nil {
+		msgs = append(msgs, e.Err.Error())
+	}
+	return "sqlp: validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// parseConstraints parses the value of the sql-validate tag.
+func parseConstraints(tag string) []constraint {
+	var cs []constraint
+	for tag != "" {
+		var opt string
+		if strings.HasPrefix(tag, ConstraintRegex+"=") {
+			opt, tag = tag, ""
+		} else {
+			opt, tag, _ = strings.Cut(tag, ",")
+		}
+
+		name, arg, _ := strings.Cut(strings.TrimSpace(opt), "=")
+		c := constraint{name: name, arg: arg}
+		switch name {
+		case ConstraintRequired:
+		case ConstraintMaxLen, ConstraintMin, ConstraintMax:
+			c.num, c.err = strconv.ParseFloat(arg, 64)
+		case ConstraintRegex:
+			c.re, c.err = regexp.Compile(arg)
+		case ConstraintEnum:
+			c.enum = strings.Split(arg, "|")
+		default:
+			c.err = fmt.Errorf("unknown constraint")
+		}
+		if c.err != nil {
+			c.err = fmt.Errorf("sqlp: invalid constraint %q: %w", opt, c.err)
+		}
+		cs = append(cs, c)
+	}
+	return cs
+}
+
+// check returns a message describing why v violates the constraint, or "" if it does not.
+func (c constraint) check(v reflect.Value) string {
+	if c.name == ConstraintRequired {
+		if v.IsZero() {
+			return "is required"
+		}
+		return ""
+	}
+
+	// the other constraints apply to the value pointers point to
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	switch c.name {
+	case ConstraintMaxLen:
+		n := 0
+		switch v.Kind() {
+		case reflect.String:
+			n = utf8.RuneCountInString(v.String())
+		case reflect.Slice, reflect.Array, reflect.Map:
+			n = v.Len()
+		default:
+			return "maxlen requires a string or slice"
+		}
+		if float64(n) > c.num {
+			return fmt.Sprintf("must be at most %s characters long", c.arg)
+		}
+	case ConstraintMin, ConstraintMax:
+		var f float64
+		switch {
+		case v.CanInt():
+			f = float64(v.Int())
+		case v.CanUint():
+			f = float64(v.Uint())
+		case v.CanFloat():
+			f = v.Float()
+		default:
+			return c.name + " requires a number"
+		}
+		if c.name == ConstraintMin && f < c.num {
+			return "must be at least " + c.arg
+		}
+		if c.name == ConstraintMax && f > c.num {
+			return "must be at most " + c.arg
+		}
+	case ConstraintRegex:
+		if v.Kind() != reflect.String {
+			return "regex requires a string"
+		}
+		if !c.re.MatchString(v.String()) {
+			return "must match " + c.arg
+		}
+	case ConstraintEnum:
+		if !slices.Contains(c.enum, fmt.Sprint(v.Interface())) {
+			return "must be one of " + strings.Join(c.enum, ", ")
+		}
+	}
+	return ""
+}
+
+// validate checks the tag constraints of the struct v and calls its Validate method. If cols is not nil,
+// only the constraints of the given columns are checked. Invalid tags of any field are returned as is.
+func validate(v reflect.Value, cols []string) error {
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	verr := &ValidationError{}
+	for _, f := range getTypeInfo(v.Type()).fields {
+		if f.err != nil {
+			return f.err
+		}
+		if cols != nil && !slices.Contains(cols, f.name) {
+			continue
+		}
+		for _, c := range f.constraints {
+			if c.err != nil {
+				return c.err
+			}
+			if msg := c.check(v.FieldByIndex(f.index)); msg != "" {
+				verr.Columns = append(verr.Columns, ColumnError{Column: f.name, Constraint: c.name, Message: msg})
+			}
+		}
+	}
+
+	if val, ok := v.Addr().Interface().(Validator); ok {
+		verr.Err = val.Validate()
+	}
+
+	if len(verr.Columns) == 0 && verr.Err == nil {
+		return nil
+	}
+	return verr
+}
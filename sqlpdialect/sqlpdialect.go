@@ -0,0 +1,313 @@
+// Package sqlpdialect contains the SQL dialects supported by sqlp.
+//
+// All queries in sqlp are written with "?" placeholders. Before a statement is sent to the database,
+// the placeholders are rewritten to the style of the dialect using Rebind.
+package sqlpdialect
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Dialect describes the differences between SQL databases that are relevant to sqlp.
+type Dialect interface {
+	// Name returns the name of the dialect.
+	Name() string
+
+	// Placeholder returns the placeholder for the n-th (1-based) argument of a statement.
+	Placeholder(n int) string
+
+	// Quote quotes the given identifier. Qualified identifiers (e.g. schema.table) are quoted per part.
+	Quote(ident string) string
+
+	// Bool returns the literal for the given boolean value.
+	Bool(b bool) string
+
+	// KeyRetrieval returns how the generated primary key is retrieved after an insert.
+	KeyRetrieval() KeyRetrieval
+
+	// MaxParams returns the maximum number of parameters of a single statement.
+	MaxParams() int
+
+	// MaxInsertRows returns the maximum number of rows of a multi-row insert. It returns 0 if the dialect does not
+	// support multi-row inserts.
+	MaxInsertRows() int
+
+	// Upsert returns the clause appended to an insert to update the given columns if a row with the same values
+	// in the conflict columns exists. If update is empty, conflicting rows are left unchanged.
+	// It returns ErrUnsupported if the dialect has no such clause.
+	Upsert(conflict []string, update []string) (string, error)
+
+	// Limit returns the clause appended after ORDER BY to return at most limit rows, skipping the first offset rows.
+	Limit(limit, offset int) string
+
+	// Exists returns a query selecting a single boolean (or 0/1) value that reports whether the query returns rows.
+	Exists(query string) string
+
+	// Savepoint returns the statements creating, rolling back to and releasing the savepoint with the given name.
+	// The release statement is empty if the dialect releases savepoints only when the transaction ends.
+	Savepoint(name string) (create, rollback, release string)
+}
+
+// ErrUnsupported is returned if a feature is not supported by the dialect.
+var ErrUnsupported = errors.New("sqlp: not supported by dialect")
+
+// KeyRetrieval defines how the generated primary key is retrieved after an insert.
+type KeyRetrieval int
+
+const (
+	// LastInsertId uses sql.Result.LastInsertId, which is not supported by all drivers.
+	LastInsertId KeyRetrieval = iota
+
+	// Returning appends "RETURNING <pk>" to the insert and reads the key from the result set.
+	Returning
+
+	// OutputInserted adds "OUTPUT INSERTED.<pk>" to the insert and reads the key from the result set.
+	OutputInserted
+
+	// ReturningInto appends "RETURNING <pk> INTO <placeholder>" to the insert and reads the key from an
+	// output parameter.
+	ReturningInto
+)
+
+var (
+	// Generic uses "?" placeholders and does not quote identifiers. It is used if no dialect is configured.
+	Generic Dialect = generic{}
+
+	// SQLite uses "?" placeholders and double-quoted identifiers.
+	SQLite Dialect = sqlite{}
+
+	// MySQL uses "?" placeholders and backtick-quoted identifiers.
+	MySQL Dialect = mysql{}
+
+	// Postgres uses "$1" placeholders and double-quoted identifiers.
+	Postgres Dialect = postgres{}
+
+	// SQLServer uses "@p1" placeholders and bracket-quoted identifiers.
+	SQLServer Dialect = sqlserver{}
+
+	// Oracle uses ":1" placeholders. Identifiers are not quoted, as quoted identifiers are case-sensitive in
+	// Oracle while unquoted ones are stored in upper case.
+	Oracle Dialect = oracle{}
+)
+
+type generic struct{}
+
+func (generic) Name() string           { return "generic" }
+func (generic) Placeholder(int) string { return "?" }
+func (generic) Quote(ident string) string {
+	return ident
+}
+func (generic) Bool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+func (generic) KeyRetrieval() KeyRetrieval { return LastInsertId }
+func (generic) MaxParams() int             { return 999 }
+func (generic) MaxInsertRows() int         { return math.MaxInt }
+func (generic) Upsert([]string, []string) (string, error) {
+	return "", ErrUnsupported
+}
+func (generic) Exists(query string) string {
+	return "SELECT EXISTS (" + query + ")"
+}
+func (generic) Savepoint(name string) (string, string, string) {
+	return "SAVEPOINT " + name, "ROLLBACK TO SAVEPOINT " + name, "RELEASE SAVEPOINT " + name
+}
+func (generic) Limit(limit, offset int) string {
+	if offset > 0 {
+		return "LIMIT " + strconv.Itoa(limit) + " OFFSET " + strconv.Itoa(offset)
+	}
+	return "LIMIT " + strconv.Itoa(limit)
+}
+
+type sqlite struct{ generic }
+
+func (sqlite) Name() string   { return "sqlite" }
+func (sqlite) MaxParams() int { return 32766 }
+func (sqlite) Quote(ident string) string {
+	return quote(ident, `"`, `"`)
+}
+func (d sqlite) Upsert(conflict []string, update []string) (string, error) {
+	return onConflict(d, conflict, update), nil
+}
+
+type mysql struct{ generic }
+
+func (mysql) Name() string   { return "mysql" }
+func (mysql) MaxParams() int { return 65535 }
+func (mysql) Quote(ident string) string {
+	return quote(ident, "`", "`")
+}
+func (d mysql) Upsert(conflict []string, update []string) (string, error) {
+	// MySQL checks all unique keys, the conflict columns can not be specified
+	if len(update) == 0 {
+		if len(conflict) == 0 {
+			return "", errors.New("sqlp: upsert requires at least one conflict or update column")
+		}
+		// assigning a column to itself leaves the row unchanged
+		return "ON DUPLICATE KEY UPDATE " + d.Quote(conflict[0]) + "=" + d.Quote(conflict[0]), nil
+	}
+
+	set := make([]string, len(update))
+	for i, c := range update {
+		set[i] = d.Quote(c) + "=VALUES(" + d.Quote(c) + ")"
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(set, ", "), nil
+}
+
+type postgres struct{ generic }
+
+func (postgres) Name() string { return "postgres" }
+func (postgres) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+func (postgres) Quote(ident string) string {
+	return quote(ident, `"`, `"`)
+}
+func (postgres) KeyRetrieval() KeyRetrieval { return Returning }
+func (postgres) MaxParams() int             { return 65535 }
+func (d postgres) Upsert(conflict []string, update []string) (string, error) {
+	return onConflict(d, conflict, update), nil
+}
+
+type sqlserver struct{ generic }
+
+func (sqlserver) Name() string { return "sqlserver" }
+func (sqlserver) Placeholder(n int) string {
+	return "@p" + strconv.Itoa(n)
+}
+func (sqlserver) Quote(ident string) string {
+	return quote(ident, "[", "]")
+}
+func (sqlserver) Bool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+func (sqlserver) KeyRetrieval() KeyRetrieval { return OutputInserted }
+func (sqlserver) MaxParams() int             { return 2100 }
+func (sqlserver) MaxInsertRows() int         { return 1000 }
+func (sqlserver) Limit(limit, offset int) string {
+	return offsetFetch(limit, offset)
+}
+func (sqlserver) Exists(query string) string {
+	return "SELECT CASE WHEN EXISTS (" + query + ") THEN 1 ELSE 0 END"
+}
+func (sqlserver) Savepoint(name string) (string, string, string) {
+	return "SAVE TRANSACTION " + name, "ROLLBACK TRANSACTION " + name, ""
+}
+
+type oracle struct{ generic }
+
+func (oracle) Name() string { return "oracle" }
+func (oracle) Placeholder(n int) string {
+	return ":" + strconv.Itoa(n)
+}
+func (oracle) Bool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+func (oracle) KeyRetrieval() KeyRetrieval { return ReturningInto }
+func (oracle) MaxParams() int             { return 65535 }
+func (oracle) MaxInsertRows() int         { return 0 } // multiple rows in VALUES require 23c
+func (oracle) Limit(limit, offset int) string {
+	return offsetFetch(limit, offset)
+}
+func (oracle) Exists(query string) string {
+	return "SELECT CASE WHEN EXISTS (" + query + ") THEN 1 ELSE 0 END FROM DUAL"
+}
+func (oracle) Savepoint(name string) (string, string, string) {
+	return "SAVEPOINT " + name, "ROLLBACK TO SAVEPOINT " + name, ""
+}
+
+type keyRetrieval struct {
+	Dialect
+	k KeyRetrieval
+}
+
+func (d keyRetrieval) KeyRetrieval() KeyRetrieval { return d.k }
+
+// WithKeyRetrieval returns the dialect with a different way of retrieving generated keys, e.g. to use
+// RETURNING with SQLite 3.35+ or MariaDB 10.5+:
+//
+//	sqlpdb.RegisterDialect(db, sqlpdialect.WithKeyRetrieval(sqlpdialect.SQLite, sqlpdialect.Returning))
+func WithKeyRetrieval(d Dialect, k KeyRetrieval) Dialect {
+	return keyRetrieval{Dialect: d, k: k}
+}
+
+// onConflict builds the "ON CONFLICT" clause supported by SQLite and PostgreSQL.
+func onConflict(d Dialect, conflict []string, update []string) string {
+	target := ""
+	if len(conflict) > 0 {
+		quoted := make([]string, len(conflict))
+		for i, c := range conflict {
+			quoted[i] = d.Quote(c)
+		}
+		target = "(" + strings.Join(quoted, ", ") + ") "
+	}
+
+	if len(update) == 0 {
+		return "ON CONFLICT " + target + "DO NOTHING"
+	}
+
+	set := make([]string, len(update))
+	for i, c := range update {
+		set[i] = d.Quote(c) + "=excluded." + d.Quote(c)
+	}
+	return "ON CONFLICT " + target + "DO UPDATE SET " + strings.Join(set, ", ")
+}
+
+// offsetFetch builds the "OFFSET ... FETCH" clause of SQL Server and Oracle 12c+, which requires an ORDER BY clause.
+func offsetFetch(limit, offset int) string {
+	return "OFFSET " + strconv.Itoa(offset) + " ROWS FETCH NEXT " + strconv.Itoa(limit) + " ROWS ONLY"
+}
+
+// quote quotes every part of a qualified identifier. Parts that are already quoted are left as they are.
+func quote(ident, open, closing string) string {
+	parts := strings.Split(ident, ".")
+	for i, p := range parts {
+		if p == "*" || strings.HasPrefix(p, open) {
+			continue
+		}
+		parts[i] = open + strings.ReplaceAll(p, closing, closing+closing) + closing
+	}
+	return strings.Join(parts, ".")
+}
+
+// Rebind rewrites the "?" placeholders of the query to the placeholder style of the dialect.
+// Question marks inside quoted strings and identifiers are left untouched.
+func Rebind(d Dialect, query string) string {
+	if d.Placeholder(1) == "?" {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+
+	n := 0
+	var inQuote rune
+	for _, r := range query {
+		switch {
+		case inQuote != 0:
+			if r == inQuote {
+				inQuote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			inQuote = r
+		case r == '?':
+			n++
+			b.WriteString(d.Placeholder(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -2,6 +2,7 @@ package sqlpin
 
 import (
 	"fmt"
+	"github.com/ByteSizedMarius/sqlp/sqlpdialect"
 	"github.com/ByteSizedMarius/sqlp/sqlputil"
 	"reflect"
 	"strings"
@@ -11,7 +12,17 @@ const (
 	InQueryReplace = "IN (*)"
 )
 
+// InQuery expands the InQueryReplace string of the query to the correct amount of "?" for the list argument.
+// An empty list matches no row; preceded by NOT, it matches every row. See InQueryDialect.
 func InQuery(query string, args []any) (string, []any, error) {
+	return InQueryDialect(sqlpdialect.Generic, query, args)
+}
+
+// InQueryDialect is InQuery, but uses the boolean literals of the given dialect for empty lists preceded by NOT.
+// As "x NOT IN (NULL)" matches no row, the comparison is replaced by an always true one, e.g. "TRUE = TRUE",
+// which requires the left operand to be a column or function call without placeholders.
+// The placeholders are still "?" and must be rewritten using sqlpdialect.Rebind.
+func InQueryDialect(d sqlpdialect.Dialect, query string, args []any) (string, []any, error) {
 	// for now, we expect that there is only one of these.
 	if strings.Count(query, InQueryReplace) > 1 {
 		return "", nil, fmt.Errorf("sqlp: only one in query is supported")
@@ -21,17 +32,17 @@ func InQuery(query string, args []any) (string, []any, error) {
 	if (strings.Count(query, "?") + strings.Count(query, InQueryReplace)) == 1 {
 		// Handle no args case
 		if len(args) == 0 {
-			newQuery := strings.Replace(query, InQueryReplace, "= FALSE", 1)
-			return newQuery, nil, nil
+			newQuery, err := emptyIn(d, query)
+			return newQuery, nil, err
 		}
 
 		// Check if the argument is a list
 		v := reflect.ValueOf(args[0])
 		if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
-			// If it's an empty list, return FALSE
+			// If it's an empty list, match nothing
 			if v.Len() == 0 {
-				newQuery := strings.Replace(query, InQueryReplace, "= FALSE", 1)
-				return newQuery, nil, nil
+				newQuery, err := emptyIn(d, query)
+				return newQuery, nil, err
 			}
 
 			// It's a non-empty list, so flatten it to become our new args
@@ -59,9 +70,9 @@ func InQuery(query string, args []any) (string, []any, error) {
 
 	argList := sqlputil.ToAny(args[argIndex])
 	if len(argList) == 0 {
-		newQuery := strings.Replace(query, InQueryReplace, "= FALSE", 1)
+		newQuery, err := emptyIn(d, query)
 		newArgs := append(args[:argIndex], args[argIndex+1:]...)
-		return newQuery, newArgs, nil
+		return newQuery, newArgs, err
 	}
 	newArgs := replaceWithFlatten(args, argList, argIndex)
 
@@ -81,3 +92,70 @@ func replaceWithFlatten(first []any, second []any, index int) []any {
 	result = append(result, first[index+1:]...)
 	return result
 }
+
+// emptyIn replaces the InQueryReplace string of the query for an empty list. "x IN (*)" becomes "x IN (NULL)",
+// which is never true. "x NOT IN (*)" has to be true for every row, including those where x is NULL, so the
+// whole comparison is replaced.
+func emptyIn(d sqlpdialect.Dialect, query string) (string, error) {
+	i := strings.Index(query, InQueryReplace)
+	before := strings.TrimRight(query[:i], " \t\r\n")
+	if len(before) < 4 || !strings.EqualFold(before[len(before)-3:], "NOT") || !isSpace(before[len(before)-4]) {
+		return query[:i] + "IN (NULL)" + query[i+len(InQueryReplace):], nil
+	}
+
+	before = strings.TrimRight(before[:len(before)-3], " \t\r\n")
+	start := operandStart(before)
+	if start == len(before) || strings.Contains(before[start:], "?") {
+		return "", fmt.Errorf("sqlp: empty not in query requires a column or function call without arguments on the left")
+	}
+	always := d.Bool(true) + " = " + d.Bool(true)
+	return before[:start] + always + query[i+len(InQueryReplace):], nil
+}
+
+// operandStart returns the index of the operand at the end of s, which is an optionally qualified and quoted
+// column or a function call.
+func operandStart(s string) int {
+	i := len(s)
+	for i > 0 {
+		switch c := s[i-1]; {
+		case c == '_' || c == '.' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			i--
+		case c == '"' || c == '`':
+			j := strings.LastIndexByte(s[:i-1], c)
+			if j < 0 {
+				return i
+			}
+			i = j
+		case c == ']':
+			j := strings.LastIndexByte(s[:i-1], '[')
+			if j < 0 {
+				return i
+			}
+			i = j
+		case c == ')':
+			depth := 0
+			j := i - 1
+			for ; j >= 0; j-- {
+				if s[j] == ')' {
+					depth++
+				} else if s[j] == '(' {
+					depth--
+				}
+				if depth == 0 {
+					break
+				}
+			}
+			if j < 0 {
+				return i
+			}
+			i = j
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
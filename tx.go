@@ -0,0 +1,116 @@
+package sqlp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	. "github.com/ByteSizedMarius/sqlp/sqlpdb"
+	"github.com/ByteSizedMarius/sqlp/sqlpdialect"
+)
+
+// Tx is a transaction started by WithTx. It implements Executor and can therefore be passed to all functions of
+// the sqlpdb package. Passing it to WithTx again runs the nested function in a savepoint.
+type Tx struct {
+	*sql.Tx
+	depth   int
+	dialect sqlpdialect.Dialect
+}
+
+// Dialect returns the dialect of the database the transaction was started on.
+func (tx *Tx) Dialect() sqlpdialect.Dialect {
+	return tx.dialect
+}
+
+// txBeginner is implemented by *sql.DB and *sql.Conn.
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// WithTx runs fn inside a transaction on db. The transaction is committed if fn returns nil and rolled back
+// if fn returns an error or panics. Panics are re-raised after the rollback.
+//
+// If db is a *Tx (or a *sql.Tx), no new transaction is started. Instead, fn is run inside a savepoint, which is
+// released if fn returns nil (where the dialect supports it) and rolled back to otherwise. This allows nesting WithTx calls:
+//
+//	err := WithTx(ctx, db, func(tx *Tx) error {
+//		// ...
+//		return WithTx(ctx, tx, func(tx *Tx) error {
+//			// only this part is rolled back if an error is returned here
+//		})
+//	})
+func WithTx(ctx context.Context, db Executor, fn func(tx *Tx) error) (err error) {
+	switch d := db.(type) {
+	case *Tx:
+		return d.savepoint(ctx, fn)
+	case *sql.Tx:
+		return (&Tx{Tx: d, dialect: DialectOf(d)}).savepoint(ctx, fn)
+	case *sql.DB:
+		if d == nil {
+			return ErrNotSet
+		}
+	}
+
+	b, ok := db.(txBeginner)
+	if !ok {
+		return fmt.Errorf("sqlp: cannot begin a transaction on %T", db)
+	}
+
+	sqlTx, err := b.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("sqlp: error beginning transaction: %w", err)
+	}
+	tx := &Tx{Tx: sqlTx, dialect: DialectOf(db)}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			err = errors.Join(err, fmt.Errorf("sqlp: error rolling back transaction: %w", rbErr))
+		}
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("sqlp: error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// savepoint runs fn in a new savepoint of the transaction.
+func (tx *Tx) savepoint(ctx context.Context, fn func(tx *Tx) error) (err error) {
+	nested := &Tx{Tx: tx.Tx, depth: tx.depth + 1, dialect: tx.dialect}
+	create, rollback, release := tx.dialect.Savepoint(fmt.Sprintf("sqlp_sp_%d", nested.depth))
+
+	if _, err = tx.ExecContext(ctx, create); err != nil {
+		return fmt.Errorf("sqlp: error creating savepoint: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_, _ = tx.ExecContext(ctx, rollback)
+			panic(p)
+		}
+	}()
+
+	if err = fn(nested); err != nil {
+		if _, rbErr := tx.ExecContext(ctx, rollback); rbErr != nil {
+			err = errors.Join(err, fmt.Errorf("sqlp: error rolling back to savepoint: %w", rbErr))
+		}
+		return err
+	}
+
+	// some databases keep savepoints until the transaction ends
+	if release == "" {
+		return nil
+	}
+	if _, err = tx.ExecContext(ctx, release); err != nil {
+		return fmt.Errorf("sqlp: error releasing savepoint: %w", err)
+	}
+	return nil
+}